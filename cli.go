@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/asunaio/apollo/config"
+	"github.com/asunaio/apollo/lib"
+	"github.com/asunaio/apollo/models"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+const usage = `usage: apollo [command]
+
+With no command, apollo serves gRPC. Commands:
+  dump -file <path> [-patches <min>[-<max>]] [-regions <region>,...]
+        Write rows of match_sums to a snapshot file.
+  load -file <path> [-patches <min>[-<max>]] [-regions <region>,...]
+        Insert rows of a snapshot file into match_sums.
+`
+
+// runCommand runs a command other than serving.
+func runCommand(name string, args []string) {
+	switch name {
+	case "dump":
+		runDump(args)
+	case "load":
+		runLoad(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// snapshotFlags are the flags shared by dump and load.
+type snapshotFlags struct {
+	file    string
+	patches string
+	regions string
+}
+
+func parseSnapshotFlags(name string, args []string) *snapshotFlags {
+	var f snapshotFlags
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&f.file, "file", "", "snapshot file")
+	fs.StringVar(&f.patches, "patches", "", "patch or inclusive patch range, e.g. 6.17-6.18 (default all)")
+	fs.StringVar(&f.regions, "regions", "", "comma separated regions, e.g. NA,EUW (default all)")
+	fs.Parse(args)
+	if f.file == "" {
+		log.Fatalf("%s: -file is required", name)
+	}
+	return &f
+}
+
+// filter builds the SnapshotFilter described by the flags.
+func (f *snapshotFlags) filter() (*models.SnapshotFilter, error) {
+	var filter models.SnapshotFilter
+
+	if f.patches != "" {
+		bounds := strings.SplitN(f.patches, "-", 2)
+		rg := &apb.PatchRange{Min: bounds[0], Max: bounds[len(bounds)-1]}
+
+		vulgate, err := models.NewVulgate()
+		if err != nil {
+			return nil, fmt.Errorf("could not instantiate Vulgate: %v", err)
+		}
+		patches := vulgate.FindPatches(rg)
+		if len(patches) == 0 {
+			return nil, fmt.Errorf("unknown patch range %q", f.patches)
+		}
+		filter.Patches = map[string]bool{}
+		for _, patch := range patches {
+			filter.Patches[patch] = true
+		}
+	}
+
+	if f.regions != "" {
+		filter.Regions = map[apb.Region]bool{}
+		for _, name := range strings.Split(f.regions, ",") {
+			region, ok := apb.Region_value[strings.ToUpper(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown region %q", name)
+			}
+			filter.Regions[apb.Region(region)] = true
+		}
+	}
+
+	return &filter, nil
+}
+
+func runDump(args []string) {
+	flags := parseSnapshotFlags("dump", args)
+	filter, err := flags.filter()
+	if err != nil {
+		log.Fatalf("dump: %v", err)
+	}
+
+	logger := logrus.New()
+	session := lib.NewCassandraSession(logger, config.Initialize())
+	defer session.Close()
+
+	out, err := os.Create(flags.file)
+	if err != nil {
+		logger.Fatalf("Could not create snapshot: %v", err)
+	}
+	defer out.Close()
+
+	n, err := models.DumpMatchSums(context.Background(), session, filter, models.NewMatchSumRowWriter(out))
+	if err != nil {
+		logger.Fatalf("Could not dump match sums after %d rows: %v", n, err)
+	}
+	logger.Infof("Dumped %d rows to %s", n, flags.file)
+}
+
+func runLoad(args []string) {
+	flags := parseSnapshotFlags("load", args)
+	filter, err := flags.filter()
+	if err != nil {
+		log.Fatalf("load: %v", err)
+	}
+
+	logger := logrus.New()
+	session := lib.NewCassandraSession(logger, config.Initialize())
+	defer session.Close()
+
+	in, err := os.Open(flags.file)
+	if err != nil {
+		logger.Fatalf("Could not open snapshot: %v", err)
+	}
+	defer in.Close()
+
+	n, err := models.LoadMatchSums(context.Background(), session, filter, models.NewMatchSumRowReader(in))
+	if err != nil {
+		logger.Fatalf("Could not load match sums after %d rows: %v", n, err)
+	}
+	logger.Infof("Loaded %d rows from %s", n, flags.file)
+}
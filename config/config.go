@@ -1,17 +1,74 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/gocql/gocql"
 	"github.com/kelseyhightower/envconfig"
 )
 
+// Database backends
+const (
+	// BackendCassandra reads match sums from Athena's Cassandra output.
+	BackendCassandra = "cassandra"
+	// BackendLocal reads match sums from snapshot files on disk, for offline development.
+	BackendLocal = "local"
+)
+
 // AppConfig represents the application config
 type AppConfig struct {
 	Port        int      `required:"true" default:"4834"`
 	MonitorPort int      `required:"true" default:"4835"`
+	DBBackend   string   `default:"cassandra"`
 	DBHost      []string `default:"127.0.0.1"`
 	DBKeyspace  string   `default:"athena_out"`
+
+	// Cassandra cluster options
+	DBProtoVersion int `default:"3"`
+	// DBConsistency is a consistency level name, e.g. QUORUM or LOCAL_ONE.
+	DBConsistency string `default:"QUORUM"`
+	DBUsername    string
+	DBPassword    string
+	DBTLS         bool
+	// DBCAPath is a CA bundle to verify the cluster's certificates with. Requires DBTLS.
+	DBCAPath         string
+	DBTLSVerifyHost  bool          `default:"true"`
+	DBLocalDC        string        // prefer hosts of this datacenter
+	DBConnectTimeout time.Duration `default:"600ms"`
+	DBTimeout        time.Duration `default:"600ms"`
+	DBRetries        int           `default:"1"`
+
+	// LocalStorePath is the directory of snapshot files used by the local backend.
+	LocalStorePath string `default:"./data"`
+
+	// SumConcurrency is the maximum number of queries run at once for a single sum or aggregation.
+	SumConcurrency int `default:"16"`
+
+	// MatchSumCacheSize is the maximum number of rows and patch sums to cache. 0 disables the cache.
+	MatchSumCacheSize int `default:"50000"`
+	// MatchSumCacheTTL is how long a cached row or patch sum lives.
+	MatchSumCacheTTL time.Duration `default:"10m"`
+
+	// BreakerWindow is the number of recent reads the circuit breaker judges the database by. 0 disables it.
+	BreakerWindow int `default:"50"`
+	// BreakerFailureRate is the fraction of failed or slow reads in the window that opens the breaker.
+	BreakerFailureRate float64 `default:"0.5"`
+	// BreakerSlowCall is the latency above which a read counts as failed.
+	BreakerSlowCall time.Duration `default:"5s"`
+	// BreakerCooldown is how long the breaker stays open before letting a trial read through.
+	BreakerCooldown time.Duration `default:"10s"`
+
+	// ConfidenceLevel is the confidence level of the intervals around win and pick rates, and of
+	// matchup significance tests.
+	ConfidenceLevel float64 `default:"0.95"`
+
+	// StaleCacheSize is the number of aggregates kept to serve, marked stale, when aggregation fails.
+	StaleCacheSize int `default:"10000"`
 }
 
 // Initialize initializes the configuration from env vars
@@ -21,5 +78,85 @@ func Initialize() *AppConfig {
 	if err != nil {
 		log.Fatalf("Could not load config: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
 	return &cfg
 }
+
+// Validate validates the configuration.
+func (c *AppConfig) Validate() error {
+	switch c.DBBackend {
+	case BackendCassandra, BackendLocal:
+	default:
+		return fmt.Errorf("unknown database backend %q", c.DBBackend)
+	}
+
+	if len(c.DBHost) == 0 {
+		return errors.New("at least one database host is required")
+	}
+	if c.DBProtoVersion < 1 || c.DBProtoVersion > 4 {
+		return fmt.Errorf("unsupported protocol version %d", c.DBProtoVersion)
+	}
+	if _, err := ParseConsistency(c.DBConsistency); err != nil {
+		return err
+	}
+	if (c.DBUsername == "") != (c.DBPassword == "") {
+		return errors.New("database username and password must be set together")
+	}
+	if c.DBCAPath != "" {
+		if !c.DBTLS {
+			return errors.New("database CA bundle requires TLS to be enabled")
+		}
+		if _, err := os.Stat(c.DBCAPath); err != nil {
+			return fmt.Errorf("could not read database CA bundle: %v", err)
+		}
+	}
+	if c.DBConnectTimeout <= 0 || c.DBTimeout <= 0 {
+		return errors.New("database timeouts must be positive")
+	}
+	if c.DBRetries < 0 {
+		return fmt.Errorf("invalid number of database retries %d", c.DBRetries)
+	}
+
+	if c.SumConcurrency < 1 {
+		return fmt.Errorf("invalid sum concurrency %d", c.SumConcurrency)
+	}
+	if c.MatchSumCacheSize < 0 || c.MatchSumCacheTTL < 0 {
+		return errors.New("match sum cache size and TTL must not be negative")
+	}
+	if c.BreakerWindow < 0 {
+		return fmt.Errorf("invalid circuit breaker window %d", c.BreakerWindow)
+	}
+	if c.BreakerWindow > 0 && (c.BreakerFailureRate <= 0 || c.BreakerFailureRate > 1) {
+		return fmt.Errorf("circuit breaker failure rate %v is not in (0, 1]", c.BreakerFailureRate)
+	}
+	if c.ConfidenceLevel <= 0 || c.ConfidenceLevel >= 1 {
+		return fmt.Errorf("confidence level %v is not in (0, 1)", c.ConfidenceLevel)
+	}
+	if c.StaleCacheSize < 0 {
+		return fmt.Errorf("invalid stale cache size %d", c.StaleCacheSize)
+	}
+	return nil
+}
+
+var consistencies = map[string]gocql.Consistency{
+	"ANY":          gocql.Any,
+	"ONE":          gocql.One,
+	"TWO":          gocql.Two,
+	"THREE":        gocql.Three,
+	"QUORUM":       gocql.Quorum,
+	"ALL":          gocql.All,
+	"LOCAL_QUORUM": gocql.LocalQuorum,
+	"EACH_QUORUM":  gocql.EachQuorum,
+	"LOCAL_ONE":    gocql.LocalOne,
+}
+
+// ParseConsistency parses a Cassandra consistency level name.
+func ParseConsistency(s string) (gocql.Consistency, error) {
+	c, ok := consistencies[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown consistency level %q", s)
+	}
+	return c, nil
+}
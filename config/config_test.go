@@ -0,0 +1,78 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() *AppConfig {
+		return &AppConfig{
+			DBBackend:        BackendCassandra,
+			DBHost:           []string{"127.0.0.1"},
+			DBProtoVersion:   3,
+			DBConsistency:    "local_one",
+			DBConnectTimeout: time.Second,
+			DBTimeout:        time.Second,
+			SumConcurrency:   16,
+			ConfidenceLevel:  0.95,
+		}
+	}
+
+	for _, test := range []struct {
+		Description string
+		Modify      func(*AppConfig)
+		WantErr     bool
+	}{
+		{
+			Description: "Valid",
+			Modify:      func(*AppConfig) {},
+		},
+		{
+			Description: "Unknown backend",
+			Modify:      func(c *AppConfig) { c.DBBackend = "mysql" },
+			WantErr:     true,
+		},
+		{
+			Description: "Unknown consistency",
+			Modify:      func(c *AppConfig) { c.DBConsistency = "MOST" },
+			WantErr:     true,
+		},
+		{
+			Description: "Username without password",
+			Modify:      func(c *AppConfig) { c.DBUsername = "apollo" },
+			WantErr:     true,
+		},
+		{
+			Description: "CA bundle without TLS",
+			Modify:      func(c *AppConfig) { c.DBCAPath = "/etc/ssl/certs/ca.pem" },
+			WantErr:     true,
+		},
+		{
+			Description: "Missing CA bundle",
+			Modify:      func(c *AppConfig) { c.DBTLS = true; c.DBCAPath = "/nonexistent/ca.pem" },
+			WantErr:     true,
+		},
+		{
+			Description: "Certain confidence",
+			Modify:      func(c *AppConfig) { c.ConfidenceLevel = 1 },
+			WantErr:     true,
+		},
+		{
+			Description: "Zero timeout",
+			Modify:      func(c *AppConfig) { c.DBTimeout = 0 },
+			WantErr:     true,
+		},
+		{
+			Description: "Negative retries",
+			Modify:      func(c *AppConfig) { c.DBRetries = -1 },
+			WantErr:     true,
+		},
+	} {
+		cfg := valid()
+		test.Modify(cfg)
+		if err := cfg.Validate(); (err != nil) != test.WantErr {
+			t.Errorf("[%v] Got error %v - Want error: %v", test.Description, err, test.WantErr)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/gocql/gocql"
+
+	"github.com/asunaio/apollo/config"
+)
+
+// NewCassandraSession connects to Cassandra.
+func NewCassandraSession(logger *logrus.Logger, cfg *config.AppConfig) *gocql.Session {
+	logger.Infof("Creating Cassandra session on %v...", cfg.DBHost)
+	session, err := newCassandraCluster(cfg).CreateSession()
+	if err != nil {
+		logger.Fatalf("Could not connect to Cassandra: %v", err)
+	}
+	logger.Infof("Connected to Cassandra")
+	return session
+}
+
+// newCassandraCluster builds the cluster config from a validated AppConfig.
+func newCassandraCluster(cfg *config.AppConfig) *gocql.ClusterConfig {
+	cluster := gocql.NewCluster(cfg.DBHost...)
+	cluster.ProtoVersion = cfg.DBProtoVersion
+	cluster.Keyspace = cfg.DBKeyspace
+	cluster.Consistency, _ = config.ParseConsistency(cfg.DBConsistency)
+	cluster.ConnectTimeout = cfg.DBConnectTimeout
+	cluster.Timeout = cfg.DBTimeout
+	cluster.RetryPolicy = &gocql.SimpleRetryPolicy{NumRetries: cfg.DBRetries}
+
+	if cfg.DBUsername != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: cfg.DBUsername,
+			Password: cfg.DBPassword,
+		}
+	}
+	if cfg.DBTLS {
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 cfg.DBCAPath,
+			EnableHostVerification: cfg.DBTLSVerifyHost,
+		}
+	}
+
+	// Route each query to a replica of its partition, preferring the local datacenter if known
+	hosts := gocql.RoundRobinHostPolicy()
+	if cfg.DBLocalDC != "" {
+		hosts = gocql.DCAwareRoundRobinPolicy(cfg.DBLocalDC)
+	}
+	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(hosts)
+
+	return cluster
+}
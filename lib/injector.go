@@ -1,10 +1,11 @@
 package lib
 
 import (
+	"expvar"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/asunaio/apollo/config"
 	"github.com/asunaio/apollo/models"
-	"github.com/gocql/gocql"
 	"github.com/simplyianm/inject"
 )
 
@@ -19,18 +20,6 @@ func NewInjector() inject.Injector {
 	cfg := config.Initialize()
 	injector.Map(cfg)
 
-	logger.Infof("Creating Cassandra session on %v...", cfg.DBHost)
-	cluster := gocql.NewCluster(cfg.DBHost...)
-	cluster.ProtoVersion = 3
-	cluster.Keyspace = cfg.DBKeyspace
-	cluster.Consistency = gocql.Quorum
-	session, err := cluster.CreateSession()
-	if err != nil {
-		logger.Fatalf("Could not connect to Cassandra: %v", err)
-	}
-	injector.Map(session)
-	logger.Infof("Connected to Cassandra")
-
 	// Vulgate
 	vulgate, err := models.NewVulgate()
 	if err != nil {
@@ -42,13 +31,50 @@ func NewInjector() inject.Injector {
 	}
 
 	// Database DAO
-	_, err = injector.ApplyMap(models.NewMatchSumDAO())
+	var matchSumDAO models.MatchSumDAO
+	switch cfg.DBBackend {
+	case config.BackendCassandra:
+		injector.Map(NewCassandraSession(logger, cfg))
+
+		matchSumDAO = models.NewMatchSumDAO(cfg.SumConcurrency)
+
+	case config.BackendLocal:
+		logger.Infof("Loading local store from %s...", cfg.LocalStorePath)
+		matchSumDAO, err = models.NewLocalMatchSumDAO(cfg.LocalStorePath)
+		if err != nil {
+			logger.Fatalf("Could not load local store: %v", err)
+		}
+		logger.Infof("Loaded local store")
+
+	default:
+		logger.Fatalf("Unknown database backend %q", cfg.DBBackend)
+	}
+
+	// Only the outermost MatchSumDAO is mapped into the injector; the ones it wraps are just applied.
+	if cfg.BreakerWindow > 0 {
+		if err = injector.Apply(matchSumDAO); err != nil {
+			logger.Fatalf("Could not inject MatchSumDAO: %v", err)
+		}
+		matchSumDAO = models.NewMatchSumBreaker(
+			matchSumDAO, cfg.BreakerWindow, cfg.BreakerFailureRate, cfg.BreakerSlowCall, cfg.BreakerCooldown)
+	}
+	if cfg.MatchSumCacheSize > 0 {
+		if err = injector.Apply(matchSumDAO); err != nil {
+			logger.Fatalf("Could not inject MatchSumDAO: %v", err)
+		}
+		cache := models.NewMatchSumCache(matchSumDAO, cfg.MatchSumCacheSize, cfg.MatchSumCacheTTL)
+		expvar.Publish("match_sum_cache", expvar.Func(func() interface{} {
+			return cache.Stats()
+		}))
+		matchSumDAO = cache
+	}
+	_, err = injector.ApplyMap(matchSumDAO)
 	if err != nil {
 		logger.Fatalf("Could not inject MatchSumDAO: %v", err)
 	}
 
 	// Setup aggregator
-	_, err = injector.ApplyMap(models.NewDeriver())
+	_, err = injector.ApplyMap(models.NewDeriver(cfg.ConfidenceLevel))
 	if err != nil {
 		logger.Fatalf("Could not inject Deriver: %v", err)
 	}
@@ -58,7 +84,7 @@ func NewInjector() inject.Injector {
 		logger.Fatalf("Could not inject Aggregator: %v", err)
 	}
 
-	_, err = injector.ApplyMap(models.NewChampionDAO())
+	_, err = injector.ApplyMap(models.NewChampionDAO(cfg.StaleCacheSize, cfg.ConfidenceLevel))
 	// _, err = injector.ApplyMap(&models.MockChampionDAO{})
 	if err != nil {
 		logger.Fatalf("Could not inject ChampionDAO: %v", err)
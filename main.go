@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"os"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/simplyianm/inject"
@@ -20,6 +21,11 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	injector := lib.NewInjector()
 	_, err := injector.Invoke(initServer)
 	if err != nil {
@@ -2,7 +2,8 @@ package models
 
 import (
 	"fmt"
-	"strings"
+
+	"golang.org/x/net/context"
 
 	apb "github.com/asunaio/apollo/gen-go/asuna"
 )
@@ -11,19 +12,22 @@ import (
 type Aggregator interface {
 	// Aggregate aggregates.
 	Aggregate(
+		ctx context.Context,
 		championId uint32,
 		enemyChampionId int32,
 		patch *apb.PatchRange,
 		tier *apb.TierRange,
 		region apb.Region,
 		role apb.Role,
-		minPlayRate float64,
+		opts DeriveOptions,
 	) (*apb.MatchAggregate, error)
 }
 
 // NewAggregator constructs a new Aggregator.
 func NewAggregator() Aggregator {
-	return &aggregatorImpl{}
+	return &aggregatorImpl{
+		flights: newFlightGroup(aggregateFlightStats),
+	}
 }
 
 // aggregatorImpl is an implementation of Aggregator.
@@ -31,27 +35,105 @@ type aggregatorImpl struct {
 	MatchSumDAO MatchSumDAO `inject:"t"`
 	Deriver     Deriver     `inject:"t"`
 	Vulgate     Vulgate     `inject:"t"`
+
+	flights *flightGroup
 }
 
-// Aggregate aggregates.
+// aggregateKey identifies the arguments of an Aggregate call.
+type aggregateKey struct {
+	championId      uint32
+	enemyChampionId int32
+	minPatch        string
+	maxPatch        string
+	minTier         uint32
+	maxTier         uint32
+	region          apb.Region
+	role            apb.Role
+	opts            DeriveOptions
+}
+
+func newAggregateKey(
+	championId uint32,
+	enemyChampionId int32,
+	patch *apb.PatchRange,
+	tier *apb.TierRange,
+	region apb.Region,
+	role apb.Role,
+	opts DeriveOptions,
+) aggregateKey {
+	key := aggregateKey{
+		championId:      championId,
+		enemyChampionId: enemyChampionId,
+		region:          region,
+		role:            role,
+		opts:            opts,
+	}
+	if patch != nil {
+		key.minPatch, key.maxPatch = patch.Min, patch.Max
+	}
+	if tier != nil {
+		key.minTier, key.maxTier = tier.Min, tier.Max
+	}
+	return key
+}
+
+// Aggregate aggregates. Concurrent identical calls share a single aggregation,
+// so the returned MatchAggregate must not be mutated.
 func (a *aggregatorImpl) Aggregate(
+	ctx context.Context,
+	aChampionId uint32,
+	enemyChampionId int32,
+	aPatch *apb.PatchRange,
+	aTier *apb.TierRange,
+	aRegion apb.Region,
+	aRole apb.Role,
+	opts DeriveOptions,
+) (*apb.MatchAggregate, error) {
+	key := newAggregateKey(aChampionId, enemyChampionId, aPatch, aTier, aRegion, aRole, opts)
+	aggregate := func() (interface{}, error) {
+		agg, err := a.aggregate(ctx, aChampionId, enemyChampionId, aPatch, aTier, aRegion, aRole, opts)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return agg, err
+	}
+	agg, err, shared := a.flights.Do(key, aggregate)
+	if shared && err != nil && ctx.Err() == nil && isContextError(err) {
+		// the caller whose aggregation we joined gave up; we have not, so aggregate ourselves
+		agg, err = aggregate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return agg.(*apb.MatchAggregate), nil
+}
+
+func (a *aggregatorImpl) aggregate(
+	ctx context.Context,
 	aChampionId uint32,
 	enemyChampionId int32,
 	aPatch *apb.PatchRange,
 	aTier *apb.TierRange,
 	aRegion apb.Region,
 	aRole apb.Role,
-	minPlayRate float64,
+	opts DeriveOptions,
 ) (*apb.MatchAggregate, error) {
-	champs, err := a.MatchSumDAO.SumsOfChampions(
-		aPatch, enemyChampionId, aTier, aRegion, aRole,
+	// Fetch every row we read in a single pass, then read them from memory
+	plan := planAggregate(a.Vulgate, aChampionId, enemyChampionId, aPatch, aTier, aRegion, aRole)
+	sums, err := plan.fetch(ctx, a.MatchSumDAO, a.Vulgate)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching sums: %v", err)
+	}
+
+	champs, err := sums.SumsOfChampions(
+		ctx, aPatch, enemyChampionId, aTier, aRegion, aRole,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error finding champion sums: %v", err)
 	}
 
-	rolesSums, err := a.MatchSumDAO.SumsOfRoles(
-		aPatch.Max, aChampionId, enemyChampionId, aTier, aRegion,
+	rolesSums, err := sums.SumsOfRoles(
+		ctx, aPatch.Max, aChampionId, enemyChampionId, aTier, aRegion,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error finding role sums: %v", err)
@@ -66,7 +148,7 @@ func (a *aggregatorImpl) Aggregate(
 			if sum == nil {
 				continue
 			}
-			patches[patch][id] = makeQuotient(sum)
+			patches[patch][id] = makeQuotient(sum, a.Vulgate)
 		}
 	}
 
@@ -80,8 +162,8 @@ func (a *aggregatorImpl) Aggregate(
 
 			// Retrieve patch if it does not exist
 			if patchSum == nil {
-				patchSum, err = a.MatchSumDAO.SumOfPatch(
-					patch, aChampionId, enemyChampionId, aTier, aRegion, aRole,
+				patchSum, err = sums.SumOfPatch(
+					ctx, patch, aChampionId, enemyChampionId, aTier, aRegion, aRole,
 				)
 				if err != nil {
 					return nil, err
@@ -97,7 +179,7 @@ func (a *aggregatorImpl) Aggregate(
 		if sum == nil {
 			continue
 		}
-		champions[id] = makeQuotient(sum)
+		champions[id] = makeQuotient(sum, a.Vulgate)
 	}
 
 	roles := map[apb.Role]*apb.MatchQuotient{}
@@ -105,11 +187,17 @@ func (a *aggregatorImpl) Aggregate(
 		if sum == nil {
 			continue
 		}
-		roles[role] = makeQuotient(sum)
+		roles[role] = makeQuotient(sum, a.Vulgate)
+	}
+
+	// changes are from the patch before the last of the range to the last
+	var lastPatch, prevPatch string
+	if prev := a.Vulgate.FindNPreviousPatches(aPatch, prevPatches); len(prev) > 1 {
+		lastPatch, prevPatch = prev[len(prev)-1], prev[len(prev)-2]
 	}
 
 	// now let us build the match aggregate
-	return a.Deriver.Derive(aRole, champions, roles, patches, aChampionId, minPlayRate)
+	return a.Deriver.Derive(aRole, champions, roles, patches, lastPatch, prevPatch, aChampionId, opts)
 }
 
 func addDelta(a *apb.MatchSum_Deltas_Delta, b *apb.MatchSum_Deltas_Delta) *apb.MatchSum_Deltas_Delta {
@@ -154,8 +242,9 @@ func addSubscalars(a, b *apb.MatchSum_Subscalars) *apb.MatchSum_Subscalars {
 	}
 }
 
-// makeQuotient creates a MatchQuotient from a MatchSum.
-func makeQuotient(sum *apb.MatchSum) *apb.MatchQuotient {
+// makeQuotient creates a MatchQuotient from a MatchSum. Core builds are derived from
+// build paths using the Vulgate's items, and skill max orders from skill orders.
+func makeQuotient(sum *apb.MatchSum, vulgate Vulgate) *apb.MatchQuotient {
 	scalars := sum.Scalars
 	plays := float64(scalars.Plays)
 	dd := sum.DurationDistribution
@@ -183,6 +272,7 @@ func makeQuotient(sum *apb.MatchSum) *apb.MatchQuotient {
 			KillingSpree:             float64(scalars.KillingSpree) / plays,
 			WardsBought:              float64(scalars.WardsBought) / plays,
 			WardsPlaced:              float64(scalars.WardsPlaced) / plays,
+			WardsKilled:              float64(scalars.WardsKilled) / plays,
 			CrowdControl:             float64(scalars.CrowdControl) / plays,
 			FirstBlood:               float64(scalars.FirstBlood) / plays,
 			FirstBloodAssist:         float64(scalars.FirstBloodAssist) / plays,
@@ -204,19 +294,21 @@ func makeQuotient(sum *apb.MatchSum) *apb.MatchQuotient {
 			WardsPlaced:     makeQuotientDeltas(sum.Deltas.WardsPlaced, dd),
 			DamageTaken:     makeQuotientDeltas(sum.Deltas.DamageTaken, dd),
 		},
-		Masteries:     makeQuotientSubscalarStringMap(sum.Masteries, plays),
-		Runes:         makeQuotientSubscalarStringMap(sum.Runes, plays),
-		Keystones:     makeQuotientSubscalarStringMap(sum.Keystones, plays),
-		Summoners:     makeQuotientSubscalarStringMap(sum.Summoners, plays),
-		Trinkets:      makeQuotientSubscalarUint32Map(sum.Trinkets, plays),
-		SkillOrders:   makeQuotientSubscalarStringMap(sum.SkillOrders, plays),
-		Durations:     makeQuotientSubscalarUint32Map(sum.Durations, plays),
-		Bans:          makeQuotientSubscalarUint32Map(sum.Bans, plays),
-		Allies:        makeQuotientSubscalarUint32Map(sum.Allies, plays),
-		Enemies:       makeQuotientSubscalarUint32Map(sum.Enemies, plays),
-		StarterItems:  makeQuotientSubscalarStringMap(sum.StarterItems, plays),
-		BuildPath:     makeQuotientSubscalarStringMap(sum.BuildPath, plays),
-		CoreBuildList: makeQuotientSubscalarStringMap(sum.BuildPath, plays), // TODO(igm): implement
+		Masteries:    makeQuotientSubscalarStringMap(sum.Masteries, plays),
+		Runes:        makeQuotientSubscalarStringMap(sum.Runes, plays),
+		Keystones:    makeQuotientSubscalarStringMap(sum.Keystones, plays),
+		Summoners:    makeQuotientSubscalarStringMap(sum.Summoners, plays),
+		Trinkets:     makeQuotientSubscalarUint32Map(sum.Trinkets, plays),
+		SkillOrders:  makeQuotientSubscalarStringMap(sum.SkillOrders, plays),
+		Durations:    makeQuotientSubscalarUint32Map(sum.Durations, plays),
+		Bans:         makeQuotientSubscalarUint32Map(sum.Bans, plays),
+		Allies:       makeQuotientSubscalarUint32Map(sum.Allies, plays),
+		Enemies:      makeQuotientSubscalarUint32Map(sum.Enemies, plays),
+		StarterItems: makeQuotientSubscalarStringMap(sum.StarterItems, plays),
+		// build paths are summed by prefix into a tree by groupBuildPaths
+		BuildPath:      makeQuotientSubscalarKeyMap(sum.BuildPath, plays),
+		CoreBuildList:  makeQuotientSubscalarKeyMap(groupCoreBuilds(vulgate, sum.BuildPath), plays),
+		SkillMaxOrders: makeQuotientSubscalarKeyMap(groupSkillMaxOrders(sum.SkillOrders), plays),
 	}
 }
 
@@ -256,7 +348,12 @@ func makeQuotientSubscalars(ss *apb.MatchSum_Subscalars, plays float64) *apb.Mat
 }
 
 func makeQuotientSubscalarStringMap(ss map[string]*apb.MatchSum_Subscalars, plays float64) map[string]*apb.MatchQuotient_Subscalars {
-	ss = aggregateSumMapByPrefix(ss)
+	return makeQuotientSubscalarKeyMap(aggregateSumMapByPrefix(ss), plays)
+}
+
+// makeQuotientSubscalarKeyMap is makeQuotientSubscalarStringMap without grouping by prefix,
+// for maps whose keys are not sequences.
+func makeQuotientSubscalarKeyMap(ss map[string]*apb.MatchSum_Subscalars, plays float64) map[string]*apb.MatchQuotient_Subscalars {
 	ret := map[string]*apb.MatchQuotient_Subscalars{}
 	for key, s := range ss {
 		ret[key] = makeQuotientSubscalars(s, plays)
@@ -272,19 +369,85 @@ func makeQuotientSubscalarUint32Map(ss map[uint32]*apb.MatchSum_Subscalars, play
 	return ret
 }
 
-// aggregateSumMapByPrefix groups keys with the same prefix together. O(n^2) because im bad.
+// aggregateSumMapByPrefix groups keys with the same prefix together: every key gets the sum of
+// the values of all keys which are a prefix of it, including itself. Keys are put in a trie so
+// the sums of shared prefixes are only added up once.
 func aggregateSumMapByPrefix(in map[string]*apb.MatchSum_Subscalars) map[string]*apb.MatchSum_Subscalars {
-	// TODO(igm): we can easily optimize this by using a trie. let's profile and see how fucked we are.
-	// fuck this
-	ret := map[string]*apb.MatchSum_Subscalars{}
-	for key, _ := range in {
-		cur := &apb.MatchSum_Subscalars{}
-		for key2, value2 := range in {
-			if strings.HasPrefix(key, key2) {
-				cur = addSubscalars(cur, value2)
-			}
+	size := 1
+	for key := range in {
+		size += len(key)
+	}
+	trie := &prefixTrie{nodes: make([]prefixTrieNode, 1, size)}
+	trie.nodes[0].firstChild = -1
+
+	ends := make(map[string]int, len(in))
+	for key, value := range in {
+		end := trie.insert(key)
+		trie.nodes[end].plays = value.Plays
+		trie.nodes[end].wins = value.Wins
+		ends[key] = end
+	}
+	trie.accumulate()
+
+	ret := make(map[string]*apb.MatchSum_Subscalars, len(in))
+	for key, end := range ends {
+		node := &trie.nodes[end]
+		ret[key] = &apb.MatchSum_Subscalars{
+			Plays: node.prefixPlays,
+			Wins:  node.prefixWins,
 		}
-		ret[key] = cur
 	}
 	return ret
 }
+
+// prefixTrie is a byte-wise trie of subscalars. Nodes are stored by index, and are always
+// added after their parent, with the root at 0. Children are linked lists of siblings, so
+// building the trie allocates nothing but the node slice.
+type prefixTrie struct {
+	nodes []prefixTrieNode
+}
+
+type prefixTrieNode struct {
+	label       byte
+	parent      int
+	firstChild  int
+	nextSibling int
+
+	// plays and wins are of the key ending at this node, if any
+	plays, wins uint64
+	// prefixPlays and prefixWins are of all keys ending at this node or above it
+	prefixPlays, prefixWins uint64
+}
+
+// insert adds the nodes of a key and returns the index of the node it ends at.
+func (t *prefixTrie) insert(key string) int {
+	cur := 0
+next:
+	for i := 0; i < len(key); i++ {
+		for child := t.nodes[cur].firstChild; child != -1; child = t.nodes[child].nextSibling {
+			if t.nodes[child].label == key[i] {
+				cur = child
+				continue next
+			}
+		}
+		t.nodes = append(t.nodes, prefixTrieNode{
+			label:       key[i],
+			parent:      cur,
+			firstChild:  -1,
+			nextSibling: t.nodes[cur].firstChild,
+		})
+		t.nodes[cur].firstChild = len(t.nodes) - 1
+		cur = len(t.nodes) - 1
+	}
+	return cur
+}
+
+// accumulate sums every node's value with those of its ancestors.
+func (t *prefixTrie) accumulate() {
+	t.nodes[0].prefixPlays, t.nodes[0].prefixWins = t.nodes[0].plays, t.nodes[0].wins
+	for i := 1; i < len(t.nodes); i++ {
+		node, parent := &t.nodes[i], &t.nodes[t.nodes[i].parent]
+		node.prefixPlays = parent.prefixPlays + node.plays
+		node.prefixWins = parent.prefixWins + node.wins
+	}
+}
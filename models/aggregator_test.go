@@ -0,0 +1,112 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// naiveAggregateSumMapByPrefix is the original quadratic aggregateSumMapByPrefix,
+// kept as a reference.
+func naiveAggregateSumMapByPrefix(in map[string]*apb.MatchSum_Subscalars) map[string]*apb.MatchSum_Subscalars {
+	ret := map[string]*apb.MatchSum_Subscalars{}
+	for key := range in {
+		cur := &apb.MatchSum_Subscalars{}
+		for key2, value2 := range in {
+			if strings.HasPrefix(key, key2) {
+				cur = addSubscalars(cur, value2)
+			}
+		}
+		ret[key] = cur
+	}
+	return ret
+}
+
+// makeBuildPathSums makes n build paths of up to depth items, sharing prefixes like real ones.
+func makeBuildPathSums(n, depth int) map[string]*apb.MatchSum_Subscalars {
+	r := rand.New(rand.NewSource(1))
+	items := []uint32{1001, 1036, 1037, 1038, 1053, 2003, 3006, 3031, 3071, 3072, 3087, 3153}
+	ret := map[string]*apb.MatchSum_Subscalars{}
+	for len(ret) < n {
+		var path []uint32
+		for i := r.Intn(depth) + 1; i > 0; i-- {
+			// favor the first few items so paths share prefixes
+			path = append(path, items[r.Intn(1+r.Intn(len(items)))])
+		}
+		plays := uint64(r.Intn(1000))
+		ret[serializeBuild(path)] = &apb.MatchSum_Subscalars{Plays: plays, Wins: plays / 2}
+	}
+	return ret
+}
+
+func TestAggregateSumMapByPrefix(t *testing.T) {
+	for _, test := range []struct {
+		Description string
+		In          map[string]*apb.MatchSum_Subscalars
+	}{
+		{
+			Description: "Empty",
+			In:          map[string]*apb.MatchSum_Subscalars{},
+		},
+		{
+			Description: "Byte prefixes",
+			In: map[string]*apb.MatchSum_Subscalars{
+				"":        {Plays: 1, Wins: 1},
+				"QWE":     {Plays: 2, Wins: 1},
+				"QWEQ":    {Plays: 4, Wins: 2},
+				"QWER":    {Plays: 8, Wins: 3},
+				"QE":      {Plays: 16, Wins: 4},
+				"1001|30": {Plays: 32, Wins: 5},
+				"1001|3":  {Plays: 64, Wins: 6},
+			},
+		},
+		{
+			Description: "Build paths",
+			In:          makeBuildPathSums(500, 8),
+		},
+	} {
+		got := aggregateSumMapByPrefix(test.In)
+		want := naiveAggregateSumMapByPrefix(test.In)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("[%s] Got %v - Want %v", test.Description, got, want)
+		}
+	}
+}
+
+func BenchmarkAggregateSumMapByPrefix(b *testing.B) {
+	for _, n := range []int{50, 500, 2000} {
+		in := makeBuildPathSums(n, 8)
+		b.Run(fmt.Sprintf("trie/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				aggregateSumMapByPrefix(in)
+			}
+		})
+		b.Run(fmt.Sprintf("naive/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				naiveAggregateSumMapByPrefix(in)
+			}
+		})
+	}
+}
+
+// BenchmarkMakeQuotient measures the per-champion work of an aggregation, most of which is
+// grouping string subscalar maps by prefix.
+func BenchmarkMakeQuotient(b *testing.B) {
+	sum := &apb.MatchSum{Scalars: &apb.MatchSum_Scalars{Plays: 10000}}
+	normalizeMatchSum(sum)
+	sum.Runes = makeBuildPathSums(200, 4)
+	sum.Masteries = makeBuildPathSums(200, 6)
+	sum.SkillOrders = makeBuildPathSums(300, 6)
+	sum.StarterItems = makeBuildPathSums(100, 3)
+	sum.BuildPath = makeBuildPathSums(2000, 8)
+	vulgate := newTestVulgate()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		makeQuotient(sum, vulgate)
+	}
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling a backend whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// callOutcome is how a call through a circuit breaker ended.
+type callOutcome int
+
+const (
+	callSucceeded callOutcome = iota
+	callFailed
+	// callAbandoned is a call ended by its caller, which says nothing of the backend.
+	callAbandoned
+)
+
+// circuitBreaker stops calls to a failing backend. It opens once at least failureRate of the
+// last window calls failed or took longer than slowCall, rejects calls for cooldown, then lets a
+// single trial call through: the breaker closes if the trial succeeds and reopens if it fails.
+// Abandoned calls are not counted, and an abandoned trial is made again.
+type circuitBreaker struct {
+	window      int
+	failureRate float64
+	slowCall    time.Duration
+	cooldown    time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	openedAt time.Time
+	trial    bool
+	// trialToken is the token of the trial in flight, or of the last one
+	trialToken uint64
+	tokens     uint64
+
+	// outcomes is a ring buffer of the last window calls, true if failed
+	outcomes []bool
+	next     int
+	count    int
+	failures int
+
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+func newCircuitBreaker(window int, failureRate float64, slowCall, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		window:      window,
+		failureRate: failureRate,
+		slowCall:    slowCall,
+		cooldown:    cooldown,
+		outcomes:    make([]bool, window),
+		now:         time.Now,
+	}
+}
+
+// Allow checks if a call may be made, returning a token for it. Every allowed call must be
+// followed by Record with its token.
+func (b *circuitBreaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens++
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return 0, ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+	case breakerHalfOpen:
+		if b.trial {
+			// only one trial at a time
+			return 0, ErrCircuitOpen
+		}
+	default:
+		return b.tokens, nil
+	}
+	b.trial = true
+	b.trialToken = b.tokens
+	return b.tokens, nil
+}
+
+// Record records the outcome of the allowed call with token.
+func (b *circuitBreaker) Record(token uint64, outcome callOutcome, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.slowCall > 0 && latency > b.slowCall {
+		outcome = callFailed
+	}
+
+	if b.state == breakerHalfOpen {
+		if token != b.trialToken {
+			// a call allowed before the breaker opened
+			return
+		}
+		b.trial = false
+		switch outcome {
+		case callFailed:
+			b.open()
+		case callSucceeded:
+			b.reset()
+		}
+		return
+	}
+	if b.state == breakerOpen {
+		// a call allowed before the breaker opened
+		return
+	}
+	if outcome == callAbandoned {
+		return
+	}
+	failed := outcome == callFailed
+
+	if b.count == b.window {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+	} else {
+		b.count++
+	}
+	b.outcomes[b.next] = failed
+	if failed {
+		b.failures++
+	}
+	b.next = (b.next + 1) % b.window
+
+	if b.count == b.window && float64(b.failures) >= b.failureRate*float64(b.window) {
+		b.open()
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.state = breakerOpen
+	b.openedAt = b.now()
+}
+
+func (b *circuitBreaker) reset() {
+	b.state = breakerClosed
+	b.next, b.count, b.failures = 0, 0, 0
+	for i := range b.outcomes {
+		b.outcomes[i] = false
+	}
+}
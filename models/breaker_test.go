@@ -0,0 +1,182 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(4, 0.5, time.Second, time.Minute)
+	now := time.Unix(0, 0)
+	b.now = func() time.Time { return now }
+
+	record := func(outcome callOutcome, latency time.Duration) {
+		token, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b.Record(token, outcome, latency)
+	}
+
+	// one failure and one slow call in a window of 4 is at the threshold
+	record(callSucceeded, 0)
+	record(callFailed, 0)
+	record(callSucceeded, 0)
+	token, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Breaker opened before window filled: %v", err)
+	}
+	b.Record(token, callSucceeded, 2*time.Second)
+	if _, err := b.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("Got %v - Want %v", err, ErrCircuitOpen)
+	}
+
+	// after the cooldown a single trial goes through
+	now = now.Add(time.Minute)
+	trial, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Trial not allowed: %v", err)
+	}
+	if _, err := b.Allow(); err != ErrCircuitOpen {
+		t.Errorf("Got %v during trial - Want %v", err, ErrCircuitOpen)
+	}
+
+	// a failed trial reopens
+	b.Record(trial, callFailed, 0)
+	if _, err := b.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("Got %v after failed trial - Want %v", err, ErrCircuitOpen)
+	}
+
+	// a successful trial closes with a fresh window
+	now = now.Add(time.Minute)
+	record(callSucceeded, 0)
+	for i := 0; i < 4; i++ {
+		record(callFailed, 0)
+	}
+	if _, err := b.Allow(); err != ErrCircuitOpen {
+		t.Errorf("Got %v - Want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestCircuitBreakerAbandoned(t *testing.T) {
+	b := newCircuitBreaker(2, 0.5, time.Second, time.Minute)
+	now := time.Unix(0, 0)
+	b.now = func() time.Time { return now }
+
+	record := func(outcome callOutcome, latency time.Duration) {
+		token, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b.Record(token, outcome, latency)
+	}
+
+	// abandoned calls neither fill the window nor offset failures
+	record(callFailed, 0)
+	for i := 0; i < 4; i++ {
+		record(callAbandoned, 0)
+	}
+	if _, err := b.Allow(); err != nil {
+		t.Fatalf("Breaker opened on abandoned calls: %v", err)
+	}
+	// but an abandoned call which was slow still failed
+	record(callAbandoned, 2*time.Second)
+	if _, err := b.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("Got %v - Want %v", err, ErrCircuitOpen)
+	}
+
+	// a call allowed before the breaker opened cannot end the trial
+	now = now.Add(time.Minute)
+	trial, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Trial not allowed: %v", err)
+	}
+	b.Record(1, callSucceeded, 0)
+	if _, err := b.Allow(); err != ErrCircuitOpen {
+		t.Errorf("Got %v after a stale call - Want %v", err, ErrCircuitOpen)
+	}
+
+	// an abandoned trial is made again without closing the breaker
+	b.Record(trial, callAbandoned, 0)
+	trial, err = b.Allow()
+	if err != nil {
+		t.Fatalf("Trial not allowed after an abandoned trial: %v", err)
+	}
+	if _, err := b.Allow(); err != ErrCircuitOpen {
+		t.Errorf("Got %v during the second trial - Want %v", err, ErrCircuitOpen)
+	}
+	b.Record(trial, callSucceeded, 0)
+	if _, err := b.Allow(); err != nil {
+		t.Errorf("Got %v after a successful trial - Want nil", err)
+	}
+}
+
+// flakyAggregator is an Aggregator which fails when err is set.
+type flakyAggregator struct {
+	err error
+}
+
+func (f *flakyAggregator) Aggregate(
+	ctx context.Context,
+	championId uint32,
+	enemyChampionId int32,
+	patch *apb.PatchRange,
+	tier *apb.TierRange,
+	region apb.Region,
+	role apb.Role,
+	opts DeriveOptions,
+) (*apb.MatchAggregate, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &apb.MatchAggregate{}, nil
+}
+
+func TestChampionDAOStale(t *testing.T) {
+	agg := &flakyAggregator{}
+	dao := NewChampionDAO(10, 0.95).(*championDAOImpl)
+	dao.Aggregator = agg
+	dao.Vulgate = newTestVulgate()
+
+	req := &apb.GetChampionRequest{
+		ChampionId: 1,
+		Patch:      &apb.PatchRange{Min: "6.18", Max: "6.18"},
+		Region:     apb.Region_NA,
+	}
+	ctx := context.Background()
+
+	champ, err := dao.Get(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if champ.Metadata.Stale {
+		t.Errorf("Fresh aggregate marked stale")
+	}
+
+	agg.err = errors.New("cassandra down")
+	champ, err = dao.Get(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !champ.Metadata.Stale {
+		t.Errorf("Fallback aggregate not marked stale")
+	}
+
+	// nothing to fall back to for a request never served
+	if _, err := dao.Get(ctx, &apb.GetChampionRequest{ChampionId: 2}); err != agg.err {
+		t.Errorf("Got %v - Want %v", err, agg.err)
+	}
+
+	// a canceled caller gets its error rather than stale data
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	agg.err = context.Canceled
+	if _, err := dao.Get(canceled, req); err != context.Canceled {
+		t.Errorf("Got %v - Want %v", err, context.Canceled)
+	}
+}
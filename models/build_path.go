@@ -0,0 +1,114 @@
+package models
+
+import (
+	"sort"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// buildPathNode is a node of a build path prefix tree, summing every path through it.
+type buildPathNode struct {
+	item     uint32
+	pickRate float64
+	// wins is the number of won matches, so win rates can be averaged by matches
+	wins     float64
+	matches  uint64
+	children map[uint32]*buildPathNode
+}
+
+func newBuildPathNode(item uint32) *buildPathNode {
+	return &buildPathNode{
+		item:     item,
+		children: map[uint32]*buildPathNode{},
+	}
+}
+
+func (n *buildPathNode) add(path *apb.MatchAggregateCollections_Build) {
+	n.pickRate += path.PickRate
+	n.wins += path.WinRate * float64(path.NumMatches)
+	n.matches += uint64(path.NumMatches)
+}
+
+// toProto converts the node and its subtree, dropping nodes below minPlayRate.
+func (n *buildPathNode) toProto(minPlayRate float64) *apb.MatchAggregateCollections_BuildNode {
+	node := &apb.MatchAggregateCollections_BuildNode{
+		Item:       n.item,
+		PickRate:   n.pickRate,
+		NumMatches: uint32(n.matches),
+	}
+	if n.matches > 0 {
+		node.WinRate = n.wins / float64(n.matches)
+	}
+	for _, child := range n.children {
+		if child.pickRate < minPlayRate {
+			continue
+		}
+		node.Children = append(node.Children, child.toProto(minPlayRate))
+	}
+	sort.Sort(buildNodesByMatches(node.Children))
+	return node
+}
+
+// groupBuildPaths folds build paths into a tree keyed by item order, whose root sums all paths.
+// Nodes below minPlayRate are pruned. It also returns every complete path of at least
+// minPlayRate, most common first; how many are returned is up to the request's query.
+func groupBuildPaths(
+	in []*apb.MatchAggregateCollections_Build, minPlayRate float64,
+) (*apb.MatchAggregateCollections_BuildNode, []*apb.MatchAggregateCollections_Build) {
+	root := newBuildPathNode(0)
+	var top []*apb.MatchAggregateCollections_Build
+	for _, path := range in {
+		node := root
+		node.add(path)
+		for _, item := range path.Build {
+			child := node.children[item]
+			if child == nil {
+				child = newBuildPathNode(item)
+				node.children[item] = child
+			}
+			child.add(path)
+			node = child
+		}
+
+		if path.PickRate >= minPlayRate {
+			top = append(top, path)
+		}
+	}
+
+	sort.Sort(buildsByMatches(top))
+	return root.toProto(minPlayRate), top
+}
+
+// buildNodesByMatches sorts build nodes by most matches, then by item.
+type buildNodesByMatches []*apb.MatchAggregateCollections_BuildNode
+
+func (b buildNodesByMatches) Len() int      { return len(b) }
+func (b buildNodesByMatches) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b buildNodesByMatches) Less(i, j int) bool {
+	if b[i].NumMatches != b[j].NumMatches {
+		return b[i].NumMatches > b[j].NumMatches
+	}
+	return b[i].Item < b[j].Item
+}
+
+// buildsByMatches sorts builds by most matches, then by items.
+type buildsByMatches []*apb.MatchAggregateCollections_Build
+
+func (b buildsByMatches) Len() int      { return len(b) }
+func (b buildsByMatches) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b buildsByMatches) Less(i, j int) bool {
+	if b[i].NumMatches != b[j].NumMatches {
+		return b[i].NumMatches > b[j].NumMatches
+	}
+	return lessItems(b[i].Build, b[j].Build)
+}
+
+// lessItems compares item sequences lexicographically.
+func lessItems(a, b []uint32) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
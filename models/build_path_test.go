@@ -0,0 +1,156 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func TestGroupBuildPaths(t *testing.T) {
+	paths := []*apb.MatchAggregateCollections_Build{
+		{Build: []uint32{1, 2, 3}, PickRate: 0.4, WinRate: 0.5, NumMatches: 40},
+		{Build: []uint32{1, 2, 4}, PickRate: 0.3, WinRate: 0.6, NumMatches: 30},
+		{Build: []uint32{1, 5}, PickRate: 0.2, WinRate: 0.45, NumMatches: 20},
+		{Build: []uint32{6}, PickRate: 0.05, WinRate: 1, NumMatches: 5},
+		{Build: []uint32{1, 2, 7}, PickRate: 0.05, WinRate: 0, NumMatches: 5},
+	}
+
+	tree, top := groupBuildPaths(paths, 0.1)
+
+	want := &apb.MatchAggregateCollections_BuildNode{
+		Item: 0, PickRate: 1, WinRate: 0.52, NumMatches: 100,
+		Children: []*apb.MatchAggregateCollections_BuildNode{
+			{
+				Item: 1, PickRate: 0.95, WinRate: 47.0 / 95, NumMatches: 95,
+				Children: []*apb.MatchAggregateCollections_BuildNode{
+					{
+						Item: 2, PickRate: 0.75, WinRate: 38.0 / 75, NumMatches: 75,
+						Children: []*apb.MatchAggregateCollections_BuildNode{
+							{Item: 3, PickRate: 0.4, WinRate: 0.5, NumMatches: 40},
+							{Item: 4, PickRate: 0.3, WinRate: 0.6, NumMatches: 30},
+						},
+					},
+					{Item: 5, PickRate: 0.2, WinRate: 0.45, NumMatches: 20},
+				},
+			},
+		},
+	}
+	if !buildNodesEqual(tree, want) {
+		t.Errorf("Got tree %v - Want %v", tree, want)
+	}
+
+	var gotTop [][]uint32
+	for _, path := range top {
+		gotTop = append(gotTop, path.Build)
+	}
+	wantTop := [][]uint32{{1, 2, 3}, {1, 2, 4}, {1, 5}}
+	if !reflect.DeepEqual(gotTop, wantTop) {
+		t.Errorf("Got top paths %v - Want %v", gotTop, wantTop)
+	}
+}
+
+func TestGroupBuildPathsOfPrefixes(t *testing.T) {
+	// paths ending early are prefixes of longer ones, and "1|2" is a byte prefix of "1|23"
+	sum := &apb.MatchSum{
+		Scalars: &apb.MatchSum_Scalars{Plays: 40, Wins: 25},
+		BuildPath: map[string]*apb.MatchSum_Subscalars{
+			"1":    {Plays: 10, Wins: 5},
+			"1|2":  {Plays: 20, Wins: 10},
+			"1|23": {Plays: 10, Wins: 10},
+		},
+	}
+	normalizeMatchSum(sum)
+	quot := makeQuotient(sum, newTestVulgate())
+	collections, err := makeMatchAggregateCollections(quot, DeriveOptions{}, 1.96)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := &apb.MatchAggregateCollections_BuildNode{
+		Item: 0, PickRate: 1, WinRate: 25.0 / 40, NumMatches: 40,
+		Children: []*apb.MatchAggregateCollections_BuildNode{
+			{
+				Item: 1, PickRate: 1, WinRate: 25.0 / 40, NumMatches: 40,
+				Children: []*apb.MatchAggregateCollections_BuildNode{
+					{Item: 2, PickRate: 0.5, WinRate: 0.5, NumMatches: 20},
+					{Item: 23, PickRate: 0.25, WinRate: 1, NumMatches: 10},
+				},
+			},
+		},
+	}
+	if tree := collections.BuildPathTree; !buildNodesEqual(tree, want) {
+		t.Errorf("Got tree %v - Want %v", tree, want)
+	}
+
+	for i, want := range []struct {
+		Build      []uint32
+		NumMatches uint32
+	}{
+		{[]uint32{1, 2}, 20},
+		{[]uint32{1}, 10},
+		{[]uint32{1, 23}, 10},
+	} {
+		if i >= len(collections.BuildPath) {
+			t.Errorf("Got %d top paths - Want 3", len(collections.BuildPath))
+			break
+		}
+		got := collections.BuildPath[i]
+		if !reflect.DeepEqual(got.Build, want.Build) || got.NumMatches != want.NumMatches {
+			t.Errorf("Got path %v with %d matches - Want %v with %d", got.Build, got.NumMatches, want.Build, want.NumMatches)
+		}
+	}
+}
+
+func TestGroupBuildPathsKeepsAll(t *testing.T) {
+	const n = 25
+	var paths []*apb.MatchAggregateCollections_Build
+	for i := 0; i < n; i++ {
+		paths = append(paths, &apb.MatchAggregateCollections_Build{
+			Build:      []uint32{uint32(i)},
+			PickRate:   0.01,
+			NumMatches: uint32(i),
+		})
+	}
+	// paths are left for the request's query to limit
+	_, top := groupBuildPaths(paths, 0)
+	if len(top) != n {
+		t.Fatalf("Got %d paths - Want %d", len(top), n)
+	}
+	for i, path := range top {
+		if path.NumMatches != uint32(n-1-i) {
+			t.Errorf("Got %d matches for path %d - Want %d", path.NumMatches, i, n-1-i)
+		}
+	}
+
+	in := &apb.MatchAggregateCollections{BuildPath: top}
+	q := &apb.CollectionQueries{BuildPath: &apb.CollectionQuery{Sort: apb.CollectionSort_GAMES, Limit: 10, PageToken: encodePageToken(20)}}
+	out, err := queryCollections(in, q)
+	if err != nil {
+		t.Fatalf("Got error %v - Want nil", err)
+	}
+	if len(out.BuildPath) != n-20 || out.NextPageTokens.BuildPath != "" {
+		t.Errorf("Got %d paths and next page token %q past 20 - Want %d and none",
+			len(out.BuildPath), out.NextPageTokens.BuildPath, n-20)
+	}
+}
+
+// buildNodesEqual compares build trees, allowing for floating point error in rates.
+func buildNodesEqual(a, b *apb.MatchAggregateCollections_BuildNode) bool {
+	if a.Item != b.Item || a.NumMatches != b.NumMatches || len(a.Children) != len(b.Children) {
+		return false
+	}
+	if !floatsEqual(a.PickRate, b.PickRate) || !floatsEqual(a.WinRate, b.WinRate) {
+		return false
+	}
+	for i := range a.Children {
+		if !buildNodesEqual(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func floatsEqual(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
@@ -15,21 +15,83 @@ type ChampionDAO interface {
 	GetMatchup(ctx context.Context, req *apb.GetMatchupRequest) (*apb.Matchup, error)
 }
 
-// NewChampionDAO returns a new ChampionDAO.
-func NewChampionDAO() ChampionDAO {
-	return &championDAOImpl{}
+// NewChampionDAO returns a new ChampionDAO. It remembers the last successful aggregate of up to
+// staleSize requests, and serves them marked as stale when aggregation fails. Matchup win rates
+// are significantly different at the given confidence level, e.g. 0.95.
+func NewChampionDAO(staleSize int, confidence float64) ChampionDAO {
+	return &championDAOImpl{
+		stale: newLRUCache(staleSize, 0),
+		alpha: 1 - confidence,
+	}
 }
 
 // championDAOImpl is an implementation of ChampionDAO.
 type championDAOImpl struct {
 	Aggregator Aggregator `inject:"t"`
 	Vulgate    Vulgate    `inject:"t"`
+
+	stale *lruCache
+	// alpha is the significance level of matchup win rate differences
+	alpha float64
+}
+
+// aggregate aggregates, falling back to the last successful aggregate of the same request if
+// the aggregation fails for any reason other than the caller giving up. The returned bool
+// reports whether the aggregate is stale.
+func (c *championDAOImpl) aggregate(
+	ctx context.Context,
+	championId uint32,
+	enemyChampionId int32,
+	patch *apb.PatchRange,
+	tier *apb.TierRange,
+	region apb.Region,
+	role apb.Role,
+	opts DeriveOptions,
+) (*apb.MatchAggregate, bool, error) {
+	key := newAggregateKey(championId, enemyChampionId, patch, tier, region, role, opts)
+	agg, err := c.Aggregator.Aggregate(ctx, championId, enemyChampionId, patch, tier, region, role, opts)
+	if err == nil {
+		c.stale.Add(key, agg)
+		return agg, false, nil
+	}
+	if ctx.Err() != nil {
+		return nil, false, err
+	}
+	if cached, ok := c.stale.Get(key); ok {
+		return cached.(*apb.MatchAggregate), true, nil
+	}
+	return nil, false, err
+}
+
+// queryAggregate sorts and pages the collections of an aggregate. Aggregates are shared
+// between requests, so a copy is returned.
+func queryAggregate(agg *apb.MatchAggregate, q *apb.CollectionQueries) (*apb.MatchAggregate, error) {
+	collections, err := queryCollections(agg.Collections, q)
+	if err != nil {
+		return nil, err
+	}
+	ret := *agg
+	ret.Collections = collections
+	return &ret, nil
 }
 
 // Get gets a champion.
 func (c *championDAOImpl) Get(ctx context.Context, req *apb.GetChampionRequest) (*apb.Champion, error) {
-	agg, err := c.Aggregator.Aggregate(
-		req.ChampionId, -1, req.Patch, req.Tier, req.Region, req.Role, req.MinPlayRate)
+	agg, stale, err := c.aggregate(
+		ctx, req.ChampionId, -1, req.Patch, req.Tier, req.Region, req.Role,
+		DeriveOptions{
+			MinPlayRate:           req.MinPlayRate,
+			PriorStrength:         req.PriorStrength,
+			GameLengthBucketWidth: req.GameLengthBucketWidth,
+			GameLengthQuantiles:   req.GameLengthQuantiles,
+			BaselineMinGames:      req.BaselineMinGames,
+			BaselineMinPickRate:   req.BaselineMinPickRate,
+			LoadoutSort:           req.LoadoutSort,
+		})
+	if err != nil {
+		return nil, err
+	}
+	agg, err = queryAggregate(agg, req.Collections)
 	if err != nil {
 		return nil, err
 	}
@@ -43,22 +105,39 @@ func (c *championDAOImpl) Get(ctx context.Context, req *apb.GetChampionRequest)
 			StaticInfo: c.Vulgate.GetChampionInfo(req.ChampionId),
 			PatchStart: patchTimes.Start,
 			PatchEnd:   patchTimes.End,
+			Stale:      stale,
 		},
 		MatchAggregate: agg,
 	}, nil
 }
 
 func (c *championDAOImpl) GetMatchup(ctx context.Context, req *apb.GetMatchupRequest) (*apb.Matchup, error) {
-	focus, err := c.Aggregator.Aggregate(
-		req.FocusChampionId, int32(req.EnemyChampionId), req.Patch, req.Tier, req.Region, req.Role, req.MinPlayRate)
+	opts := DeriveOptions{
+		MinPlayRate:           req.MinPlayRate,
+		PriorStrength:         req.PriorStrength,
+		GameLengthBucketWidth: req.GameLengthBucketWidth,
+		GameLengthQuantiles:   req.GameLengthQuantiles,
+		BaselineMinGames:      req.BaselineMinGames,
+		BaselineMinPickRate:   req.BaselineMinPickRate,
+		LoadoutSort:           req.LoadoutSort,
+	}
+	focus, focusStale, err := c.aggregate(
+		ctx, req.FocusChampionId, int32(req.EnemyChampionId), req.Patch, req.Tier, req.Region, req.Role, opts)
 	if err != nil {
 		return nil, err
 	}
-	enemy, err := c.Aggregator.Aggregate(
-		req.EnemyChampionId, int32(req.FocusChampionId), req.Patch, req.Tier, req.Region, req.Role, req.MinPlayRate)
+	enemy, enemyStale, err := c.aggregate(
+		ctx, req.EnemyChampionId, int32(req.FocusChampionId), req.Patch, req.Tier, req.Region, req.Role, opts)
 	if err != nil {
 		return nil, err
 	}
+	significance := matchupSignificance(focus, c.alpha)
+	if focus, err = queryAggregate(focus, req.Collections); err != nil {
+		return nil, err
+	}
+	if enemy, err = queryAggregate(enemy, req.Collections); err != nil {
+		return nil, err
+	}
 
 	// TODO(igm): implement
 
@@ -70,6 +149,7 @@ func (c *championDAOImpl) GetMatchup(ctx context.Context, req *apb.GetMatchupReq
 				StaticInfo: c.Vulgate.GetChampionInfo(req.FocusChampionId),
 				PatchStart: patchTimes.Start,
 				PatchEnd:   patchTimes.End,
+				Stale:      focusStale,
 			},
 			MatchAggregate: focus,
 		},
@@ -78,8 +158,10 @@ func (c *championDAOImpl) GetMatchup(ctx context.Context, req *apb.GetMatchupReq
 				StaticInfo: c.Vulgate.GetChampionInfo(req.EnemyChampionId),
 				PatchStart: patchTimes.Start,
 				PatchEnd:   patchTimes.End,
+				Stale:      enemyStale,
 			},
 			MatchAggregate: enemy,
 		},
+		Significance: significance,
 	}, nil
 }
@@ -0,0 +1,391 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// ErrInvalidPageToken is returned for a page token not returned by a previous page.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// collectionEntry is implemented by the entries of every collection.
+type collectionEntry interface {
+	GetPickRate() float64
+	GetWinRate() float64
+	GetNumMatches() uint32
+	GetWinRateInterval() *apb.Interval
+}
+
+// queryCollections sorts, limits and pages every collection of an aggregate by its query.
+// Collections without a query are sorted by pick rate and returned whole. The aggregate's
+// collections are shared, so new ones are returned.
+func queryCollections(
+	in *apb.MatchAggregateCollections, q *apb.CollectionQueries,
+) (*apb.MatchAggregateCollections, error) {
+	if in == nil {
+		return nil, nil
+	}
+	if q == nil {
+		q = &apb.CollectionQueries{}
+	}
+	out := *in
+	next := &apb.CollectionPageTokens{}
+	out.NextPageTokens = next
+
+	var err error
+	if out.Runes, next.Runes, err = queryRuneSets(in.Runes, q.Runes); err != nil {
+		return nil, err
+	}
+	if out.Masteries, next.Masteries, err = queryMasterySets(in.Masteries, q.Masteries); err != nil {
+		return nil, err
+	}
+	if out.Keystones, next.Keystones, err = queryKeystones(in.Keystones, q.Keystones); err != nil {
+		return nil, err
+	}
+	if out.SummonerSpells, next.SummonerSpells, err = querySummonerSets(in.SummonerSpells, q.SummonerSpells); err != nil {
+		return nil, err
+	}
+	if out.Trinkets, next.Trinkets, err = queryTrinkets(in.Trinkets, q.Trinkets); err != nil {
+		return nil, err
+	}
+	if out.SkillOrders, next.SkillOrders, err = querySkillOrders(in.SkillOrders, q.SkillOrders); err != nil {
+		return nil, err
+	}
+	if out.SkillMaxOrders, next.SkillMaxOrders, err = querySkillMaxOrders(in.SkillMaxOrders, q.SkillMaxOrders); err != nil {
+		return nil, err
+	}
+	if out.StarterItems, next.StarterItems, err = queryBuilds(in.StarterItems, q.StarterItems); err != nil {
+		return nil, err
+	}
+	if out.BuildPath, next.BuildPath, err = queryBuilds(in.BuildPath, q.BuildPath); err != nil {
+		return nil, err
+	}
+	if out.CoreBuildList, next.CoreBuildList, err = queryBuilds(in.CoreBuildList, q.CoreBuildList); err != nil {
+		return nil, err
+	}
+	if out.Matchups, next.Matchups, err = queryMatchups(in.Matchups, q.Matchups); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// queryRuneSets queries a collection of rune sets.
+func queryRuneSets(
+	in []*apb.MatchAggregateCollections_RuneSet, q *apb.CollectionQuery,
+) ([]*apb.MatchAggregateCollections_RuneSet, string, error) {
+	page, next, err := queryCollection(runeSetEntries(in), q)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []*apb.MatchAggregateCollections_RuneSet
+	for _, e := range page {
+		out = append(out, e.(*apb.MatchAggregateCollections_RuneSet))
+	}
+	return out, next, nil
+}
+
+func runeSetEntries(in []*apb.MatchAggregateCollections_RuneSet) []collectionEntry {
+	entries := make([]collectionEntry, len(in))
+	for i, e := range in {
+		entries[i] = e
+	}
+	return entries
+}
+
+// queryMasterySets queries a collection of mastery sets.
+func queryMasterySets(
+	in []*apb.MatchAggregateCollections_MasterySet, q *apb.CollectionQuery,
+) ([]*apb.MatchAggregateCollections_MasterySet, string, error) {
+	page, next, err := queryCollection(masterySetEntries(in), q)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []*apb.MatchAggregateCollections_MasterySet
+	for _, e := range page {
+		out = append(out, e.(*apb.MatchAggregateCollections_MasterySet))
+	}
+	return out, next, nil
+}
+
+func masterySetEntries(in []*apb.MatchAggregateCollections_MasterySet) []collectionEntry {
+	entries := make([]collectionEntry, len(in))
+	for i, e := range in {
+		entries[i] = e
+	}
+	return entries
+}
+
+// queryKeystones queries a collection of keystones.
+func queryKeystones(
+	in []*apb.MatchAggregateCollections_Keystone, q *apb.CollectionQuery,
+) ([]*apb.MatchAggregateCollections_Keystone, string, error) {
+	page, next, err := queryCollection(keystoneEntries(in), q)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []*apb.MatchAggregateCollections_Keystone
+	for _, e := range page {
+		out = append(out, e.(*apb.MatchAggregateCollections_Keystone))
+	}
+	return out, next, nil
+}
+
+func keystoneEntries(in []*apb.MatchAggregateCollections_Keystone) []collectionEntry {
+	entries := make([]collectionEntry, len(in))
+	for i, e := range in {
+		entries[i] = e
+	}
+	return entries
+}
+
+// querySummonerSets queries a collection of summoner spell sets.
+func querySummonerSets(
+	in []*apb.MatchAggregateCollections_SummonerSet, q *apb.CollectionQuery,
+) ([]*apb.MatchAggregateCollections_SummonerSet, string, error) {
+	page, next, err := queryCollection(summonerSetEntries(in), q)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []*apb.MatchAggregateCollections_SummonerSet
+	for _, e := range page {
+		out = append(out, e.(*apb.MatchAggregateCollections_SummonerSet))
+	}
+	return out, next, nil
+}
+
+func summonerSetEntries(in []*apb.MatchAggregateCollections_SummonerSet) []collectionEntry {
+	entries := make([]collectionEntry, len(in))
+	for i, e := range in {
+		entries[i] = e
+	}
+	return entries
+}
+
+// queryTrinkets queries a collection of trinkets.
+func queryTrinkets(
+	in []*apb.MatchAggregateCollections_Trinket, q *apb.CollectionQuery,
+) ([]*apb.MatchAggregateCollections_Trinket, string, error) {
+	page, next, err := queryCollection(trinketEntries(in), q)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []*apb.MatchAggregateCollections_Trinket
+	for _, e := range page {
+		out = append(out, e.(*apb.MatchAggregateCollections_Trinket))
+	}
+	return out, next, nil
+}
+
+func trinketEntries(in []*apb.MatchAggregateCollections_Trinket) []collectionEntry {
+	entries := make([]collectionEntry, len(in))
+	for i, e := range in {
+		entries[i] = e
+	}
+	return entries
+}
+
+// querySkillOrders queries a collection of skill orders.
+func querySkillOrders(
+	in []*apb.MatchAggregateCollections_SkillOrder, q *apb.CollectionQuery,
+) ([]*apb.MatchAggregateCollections_SkillOrder, string, error) {
+	page, next, err := queryCollection(skillOrderEntries(in), q)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []*apb.MatchAggregateCollections_SkillOrder
+	for _, e := range page {
+		out = append(out, e.(*apb.MatchAggregateCollections_SkillOrder))
+	}
+	return out, next, nil
+}
+
+func skillOrderEntries(in []*apb.MatchAggregateCollections_SkillOrder) []collectionEntry {
+	entries := make([]collectionEntry, len(in))
+	for i, e := range in {
+		entries[i] = e
+	}
+	return entries
+}
+
+// querySkillMaxOrders queries a collection of skill max orders.
+func querySkillMaxOrders(
+	in []*apb.MatchAggregateCollections_SkillMaxOrder, q *apb.CollectionQuery,
+) ([]*apb.MatchAggregateCollections_SkillMaxOrder, string, error) {
+	page, next, err := queryCollection(skillMaxOrderEntries(in), q)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []*apb.MatchAggregateCollections_SkillMaxOrder
+	for _, e := range page {
+		out = append(out, e.(*apb.MatchAggregateCollections_SkillMaxOrder))
+	}
+	return out, next, nil
+}
+
+func skillMaxOrderEntries(in []*apb.MatchAggregateCollections_SkillMaxOrder) []collectionEntry {
+	entries := make([]collectionEntry, len(in))
+	for i, e := range in {
+		entries[i] = e
+	}
+	return entries
+}
+
+// queryBuilds queries a collection of builds.
+func queryBuilds(
+	in []*apb.MatchAggregateCollections_Build, q *apb.CollectionQuery,
+) ([]*apb.MatchAggregateCollections_Build, string, error) {
+	page, next, err := queryCollection(buildEntries(in), q)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []*apb.MatchAggregateCollections_Build
+	for _, e := range page {
+		out = append(out, e.(*apb.MatchAggregateCollections_Build))
+	}
+	return out, next, nil
+}
+
+func buildEntries(in []*apb.MatchAggregateCollections_Build) []collectionEntry {
+	entries := make([]collectionEntry, len(in))
+	for i, e := range in {
+		entries[i] = e
+	}
+	return entries
+}
+
+// queryMatchups queries a collection of matchups.
+func queryMatchups(
+	in []*apb.MatchAggregateCollections_Matchup, q *apb.CollectionQuery,
+) ([]*apb.MatchAggregateCollections_Matchup, string, error) {
+	page, next, err := queryCollection(matchupEntries(in), q)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []*apb.MatchAggregateCollections_Matchup
+	for _, e := range page {
+		out = append(out, e.(*apb.MatchAggregateCollections_Matchup))
+	}
+	return out, next, nil
+}
+
+func matchupEntries(in []*apb.MatchAggregateCollections_Matchup) []collectionEntry {
+	entries := make([]collectionEntry, len(in))
+	for i, e := range in {
+		entries[i] = e
+	}
+	return entries
+}
+
+// queryCollection sorts a collection by the query's sort key, highest first, and returns
+// the page starting at its page token. Ties keep their order, so a collection in a
+// deterministic order is paged deterministically. The returned token is empty on the last page.
+func queryCollection(entries []collectionEntry, q *apb.CollectionQuery) ([]collectionEntry, string, error) {
+	if q == nil {
+		q = &apb.CollectionQuery{}
+	}
+	offset, err := decodePageToken(q.PageToken)
+	if err != nil {
+		return nil, "", err
+	}
+	if offset > len(entries) {
+		return nil, "", ErrInvalidPageToken
+	}
+
+	sorted := make([]collectionEntry, len(entries))
+	copy(sorted, entries)
+	sort.Stable(collectionSorter{entries: sorted, key: q.Sort})
+
+	end := len(sorted)
+	if q.Limit > 0 && offset+int(q.Limit) < end {
+		end = offset + int(q.Limit)
+	}
+	var next string
+	if end < len(sorted) {
+		next = encodePageToken(end)
+	}
+	return sorted[offset:end], next, nil
+}
+
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidPageToken
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidPageToken
+	}
+	return offset, nil
+}
+
+// collectionSorter sorts collection entries by a sort key, highest first. Entries without
+// games, whose win rates are NaN, sort last.
+type collectionSorter struct {
+	entries []collectionEntry
+	key     apb.CollectionSort
+}
+
+func (c collectionSorter) Len() int      { return len(c.entries) }
+func (c collectionSorter) Swap(i, j int) { c.entries[i], c.entries[j] = c.entries[j], c.entries[i] }
+func (c collectionSorter) Less(i, j int) bool {
+	return c.higher(c.entries[i], c.entries[j])
+}
+
+// higher checks if a sorts before b, NaNs after any number.
+func (c collectionSorter) higher(a, b collectionEntry) bool {
+	va, vb := c.value(a), c.value(b)
+	if math.IsNaN(va) || math.IsNaN(vb) {
+		return !math.IsNaN(va)
+	}
+	return va > vb
+}
+
+func (c collectionSorter) value(e collectionEntry) float64 {
+	switch c.key {
+	case apb.CollectionSort_WIN_RATE:
+		return e.GetWinRate()
+	case apb.CollectionSort_WIN_RATE_LOWER_BOUND:
+		if interval := e.GetWinRateInterval(); interval != nil {
+			return interval.Lower
+		}
+		return 0
+	case apb.CollectionSort_GAMES:
+		return float64(e.GetNumMatches())
+	default:
+		return e.GetPickRate()
+	}
+}
+
+// sortedStringKeys gets the keys of a subscalars map in order, so collections built from it
+// come out the same on every call.
+func sortedStringKeys(m map[string]*apb.MatchQuotient_Subscalars) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedUint32Keys is sortedStringKeys for maps keyed by id.
+func sortedUint32Keys(m map[uint32]*apb.MatchQuotient_Subscalars) []uint32 {
+	keys := make([]uint32, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Sort(uint32Slice(keys))
+	return keys
+}
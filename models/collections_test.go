@@ -0,0 +1,110 @@
+package models
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func makeTestTrinkets() []*apb.MatchAggregateCollections_Trinket {
+	return []*apb.MatchAggregateCollections_Trinket{
+		{Trinket: 1, PickRate: 0.2, WinRate: 0.6, NumMatches: 20, WinRateInterval: &apb.Interval{Lower: 0.4, Upper: 0.8}},
+		{Trinket: 2, PickRate: 0.5, WinRate: 0.5, NumMatches: 50, WinRateInterval: &apb.Interval{Lower: 0.45, Upper: 0.55}},
+		{Trinket: 3, PickRate: 0.3, WinRate: 0.55, NumMatches: 30, WinRateInterval: &apb.Interval{Lower: 0.5, Upper: 0.6}},
+		{Trinket: 4, PickRate: 0.2, WinRate: 0.4, NumMatches: 20},
+	}
+}
+
+func trinketIds(trinkets []*apb.MatchAggregateCollections_Trinket) []uint32 {
+	var ret []uint32
+	for _, trinket := range trinkets {
+		ret = append(ret, trinket.Trinket)
+	}
+	return ret
+}
+
+func TestQueryCollections(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		query *apb.CollectionQuery
+		ids   []uint32
+		next  string
+	}{
+		{"default", nil, []uint32{2, 3, 1, 4}, ""},
+		{"win rate", &apb.CollectionQuery{Sort: apb.CollectionSort_WIN_RATE}, []uint32{1, 3, 2, 4}, ""},
+		{
+			"win rate lower bound",
+			&apb.CollectionQuery{Sort: apb.CollectionSort_WIN_RATE_LOWER_BOUND},
+			[]uint32{3, 2, 1, 4}, "",
+		},
+		{"games", &apb.CollectionQuery{Sort: apb.CollectionSort_GAMES}, []uint32{2, 3, 1, 4}, ""},
+		{"limit", &apb.CollectionQuery{Limit: 2}, []uint32{2, 3}, encodePageToken(2)},
+		{
+			"second page",
+			&apb.CollectionQuery{Limit: 2, PageToken: encodePageToken(2)},
+			[]uint32{1, 4}, "",
+		},
+		{
+			"partial last page",
+			&apb.CollectionQuery{Limit: 3, PageToken: encodePageToken(3)},
+			[]uint32{4}, "",
+		},
+		{"limit past end", &apb.CollectionQuery{Limit: 10}, []uint32{2, 3, 1, 4}, ""},
+	} {
+		in := &apb.MatchAggregateCollections{Trinkets: makeTestTrinkets()}
+		out, err := queryCollections(in, &apb.CollectionQueries{Trinkets: test.query})
+		if err != nil {
+			t.Errorf("[%v] Got error %v - Want nil", test.name, err)
+			continue
+		}
+		if ids := trinketIds(out.Trinkets); !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("[%v] Got %v - Want %v", test.name, ids, test.ids)
+		}
+		if next := out.NextPageTokens.Trinkets; next != test.next {
+			t.Errorf("[%v] Got next page token %q - Want %q", test.name, next, test.next)
+		}
+		// the input is shared and must be left alone
+		if ids := trinketIds(in.Trinkets); !reflect.DeepEqual(ids, []uint32{1, 2, 3, 4}) {
+			t.Errorf("[%v] Got input %v - Want unchanged", test.name, ids)
+		}
+	}
+}
+
+func TestQueryCollectionsNaN(t *testing.T) {
+	// entries without games have NaN win rates, which sort last wherever they start
+	for _, order := range [][]uint32{{5, 1, 2, 3}, {1, 5, 2, 3}, {1, 2, 3, 5}} {
+		byId := map[uint32]*apb.MatchAggregateCollections_Trinket{
+			1: {Trinket: 1, WinRate: 0.6},
+			2: {Trinket: 2, WinRate: 0.4},
+			3: {Trinket: 3, WinRate: 0.5},
+			5: {Trinket: 5, WinRate: math.NaN()},
+		}
+		var trinkets []*apb.MatchAggregateCollections_Trinket
+		for _, id := range order {
+			trinkets = append(trinkets, byId[id])
+		}
+		in := &apb.MatchAggregateCollections{Trinkets: trinkets}
+		out, err := queryCollections(in, &apb.CollectionQueries{
+			Trinkets: &apb.CollectionQuery{Sort: apb.CollectionSort_WIN_RATE},
+		})
+		if err != nil {
+			t.Errorf("[%v] Got error %v - Want nil", order, err)
+			continue
+		}
+		if ids := trinketIds(out.Trinkets); !reflect.DeepEqual(ids, []uint32{1, 3, 2, 5}) {
+			t.Errorf("[%v] Got %v - Want %v", order, ids, []uint32{1, 3, 2, 5})
+		}
+	}
+}
+
+func TestQueryCollectionsInvalidPageToken(t *testing.T) {
+	for _, token := range []string{"!!", encodePageToken(5), "LTE"} {
+		in := &apb.MatchAggregateCollections{Trinkets: makeTestTrinkets()}
+		q := &apb.CollectionQueries{Trinkets: &apb.CollectionQuery{PageToken: token}}
+		if _, err := queryCollections(in, q); err != ErrInvalidPageToken {
+			t.Errorf("[%v] Got %v - Want %v", token, err, ErrInvalidPageToken)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"math"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// wilsonInterval computes the Wilson score interval of a proportion p observed over n trials,
+// where z is the standard normal quantile of the confidence level. Unlike the normal
+// approximation, it stays within [0, 1] and stays wide for small n.
+func wilsonInterval(p, n, z float64) *apb.Interval {
+	if n <= 0 || math.IsNaN(p) {
+		return &apb.Interval{Lower: 0, Upper: 1}
+	}
+	p = math.Max(0, math.Min(1, p))
+
+	z2 := z * z
+	denom := 1 + z2/n
+	center := (p + z2/(2*n)) / denom
+	margin := z / denom * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	return &apb.Interval{
+		Lower: math.Max(0, center-margin),
+		Upper: math.Min(1, center+margin),
+	}
+}
+
+// confidenceZ gets the two-sided standard normal quantile of a confidence level in (0, 1),
+// e.g. 1.96 for 0.95.
+func confidenceZ(level float64) float64 {
+	return normalQuantile(1 - (1-level)/2)
+}
+
+// normalQuantile is the inverse of the standard normal CDF, using Acklam's rational
+// approximation refined with one step of Halley's method.
+func normalQuantile(p float64) float64 {
+	if p <= 0 {
+		return math.Inf(-1)
+	}
+	if p >= 1 {
+		return math.Inf(1)
+	}
+
+	const pLow = 0.02425
+	a := [...]float64{-3.969683028665376e+01, 2.209460984245205e+02, -2.759285104469687e+02,
+		1.383577518672690e+02, -3.066479806614716e+01, 2.506628277459239e+00}
+	b := [...]float64{-5.447609879822406e+01, 1.615858368580409e+02, -1.556989798598866e+02,
+		6.680131188771972e+01, -1.328068155288572e+01}
+	c := [...]float64{-7.784894002430293e-03, -3.223964580411365e-01, -2.400758277161838e+00,
+		-2.549732539343734e+00, 4.374664141464968e+00, 2.938163982698783e+00}
+	d := [...]float64{7.784695709041462e-03, 3.224671290700398e-01, 2.445134137142996e+00,
+		3.754408661907416e+00}
+
+	var x float64
+	switch {
+	case p < pLow:
+		q := math.Sqrt(-2 * math.Log(p))
+		x = (((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	case p <= 1-pLow:
+		q := p - 0.5
+		r := q * q
+		x = (((((a[0]*r+a[1])*r+a[2])*r+a[3])*r+a[4])*r + a[5]) * q /
+			(((((b[0]*r+b[1])*r+b[2])*r+b[3])*r+b[4])*r + 1)
+	default:
+		q := math.Sqrt(-2 * math.Log(1-p))
+		x = -(((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	}
+
+	e := 0.5*math.Erfc(-x/math.Sqrt2) - p
+	u := e * math.Sqrt(2*math.Pi) * math.Exp(x*x/2)
+	return x - u/(1+x*u/2)
+}
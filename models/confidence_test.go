@@ -0,0 +1,45 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalQuantile(t *testing.T) {
+	for _, test := range []struct {
+		P    float64
+		Want float64
+	}{
+		{P: 0.5, Want: 0},
+		{P: 0.975, Want: 1.959964},
+		{P: 0.995, Want: 2.575829},
+		{P: 0.01, Want: -2.326348},
+		{P: 0.00001, Want: -4.264891},
+	} {
+		if got := normalQuantile(test.P); math.Abs(got-test.Want) > 1e-6 {
+			t.Errorf("[%v] Got %v - Want %v", test.P, got, test.Want)
+		}
+	}
+}
+
+func TestWilsonInterval(t *testing.T) {
+	z := confidenceZ(0.95)
+	for _, test := range []struct {
+		Description string
+		P           float64
+		N           float64
+		Lower       float64
+		Upper       float64
+	}{
+		{Description: "No games", P: 0, N: 0, Lower: 0, Upper: 1},
+		{Description: "Three games", P: 2.0 / 3, N: 3, Lower: 0.207660, Upper: 0.938508},
+		{Description: "Many games", P: 0.52, N: 10000, Lower: 0.510202, Upper: 0.529782},
+		{Description: "All wins", P: 1, N: 10, Lower: 0.722467, Upper: 1},
+		{Description: "No wins", P: 0, N: 10, Lower: 0, Upper: 0.277533},
+	} {
+		got := wilsonInterval(test.P, test.N, z)
+		if math.Abs(got.Lower-test.Lower) > 1e-6 || math.Abs(got.Upper-test.Upper) > 1e-6 {
+			t.Errorf("[%s] Got [%v, %v] - Want [%v, %v]", test.Description, got.Lower, got.Upper, test.Lower, test.Upper)
+		}
+	}
+}
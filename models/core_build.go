@@ -0,0 +1,76 @@
+package models
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// coreBuildSize is the number of completed items making up a core build.
+const coreBuildSize = 3
+
+// isCompletedItem checks if an item is finished: it builds into nothing and is not consumed.
+// Unknown items are not.
+func isCompletedItem(item *apb.Vulgate_Item) bool {
+	return item != nil && len(item.Into) == 0 && !item.Consumable
+}
+
+// coreBuild extracts the first coreBuildSize completed items of a build path, sorted so the
+// same items bought in any order make the same core build. It returns false if the path
+// completes fewer items.
+func coreBuild(vulgate Vulgate, path []uint32) ([]uint32, bool) {
+	var core []uint32
+	for _, item := range path {
+		if !isCompletedItem(vulgate.GetItemInfo(item)) {
+			continue
+		}
+		core = append(core, item)
+		if len(core) == coreBuildSize {
+			sort.Sort(uint32Slice(core))
+			return core, true
+		}
+	}
+	return nil, false
+}
+
+// groupCoreBuilds sums build paths by their core build, keyed like build paths.
+// Paths which cannot be parsed or do not complete a core build are left out.
+func groupCoreBuilds(
+	vulgate Vulgate, paths map[string]*apb.MatchSum_Subscalars,
+) map[string]*apb.MatchSum_Subscalars {
+	ret := map[string]*apb.MatchSum_Subscalars{}
+	for key, stats := range paths {
+		path, err := deserializeBuild(key)
+		if err != nil {
+			continue
+		}
+		core, ok := coreBuild(vulgate, path)
+		if !ok {
+			continue
+		}
+		coreKey := serializeBuild(core)
+		cur := ret[coreKey]
+		if cur == nil {
+			cur = &apb.MatchSum_Subscalars{}
+		}
+		ret[coreKey] = addSubscalars(cur, stats)
+	}
+	return ret
+}
+
+// serializeBuild is the inverse of deserializeBuild.
+func serializeBuild(items []uint32) string {
+	strs := make([]string, len(items))
+	for i, item := range items {
+		strs[i] = strconv.FormatUint(uint64(item), 10)
+	}
+	return strings.Join(strs, "|")
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
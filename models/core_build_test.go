@@ -0,0 +1,73 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func newTestItemVulgate() *vulgateImpl {
+	vulgate := newTestVulgate()
+	vulgate.proto.Items = map[uint32]*apb.Vulgate_Item{
+		// components
+		1036: {Id: 1036, Into: []uint32{3071}},
+		1001: {Id: 1001, Into: []uint32{3006}},
+		// consumable
+		2003: {Id: 2003, Consumable: true},
+		// completed
+		3006: {Id: 3006, From: []uint32{1001}},
+		3071: {Id: 3071, From: []uint32{1036}},
+		3031: {Id: 3031},
+		3153: {Id: 3153},
+	}
+	return vulgate
+}
+
+func TestCoreBuild(t *testing.T) {
+	vulgate := newTestItemVulgate()
+	for _, test := range []struct {
+		Description string
+		Path        []uint32
+		Want        []uint32
+		WantOK      bool
+	}{
+		{
+			Description: "Components and consumables are skipped",
+			Path:        []uint32{2003, 1036, 3071, 1001, 3006, 2003, 3031, 3153},
+			Want:        []uint32{3006, 3031, 3071},
+			WantOK:      true,
+		},
+		{
+			Description: "Unknown items are skipped",
+			Path:        []uint32{9999, 3153, 3031, 3071},
+			Want:        []uint32{3031, 3071, 3153},
+			WantOK:      true,
+		},
+		{
+			Description: "Too few completed items",
+			Path:        []uint32{1036, 3071, 3006},
+		},
+	} {
+		got, ok := coreBuild(vulgate, test.Path)
+		if ok != test.WantOK || !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("[%s] Got %v, %v - Want %v, %v", test.Description, got, ok, test.Want, test.WantOK)
+		}
+	}
+}
+
+func TestGroupCoreBuilds(t *testing.T) {
+	got := groupCoreBuilds(newTestItemVulgate(), map[string]*apb.MatchSum_Subscalars{
+		"3071|3006|3031":      {Plays: 10, Wins: 6},
+		"1001|3006|3031|3071": {Plays: 5, Wins: 2},
+		"3031|3153|3006":      {Plays: 3, Wins: 3},
+		"3071|3006":           {Plays: 7, Wins: 1},
+	})
+	want := map[string]*apb.MatchSum_Subscalars{
+		"3006|3031|3071": {Plays: 15, Wins: 8},
+		"3006|3031|3153": {Plays: 3, Wins: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v - Want %v", got, want)
+	}
+}
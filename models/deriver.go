@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -15,46 +16,95 @@ type Deriver interface {
 	// Derive derives a MatchAggregate from a map of MatchQuotients and a champion id.
 	// - Champions is a map of all champions to their match quotient for the current role
 	// - Roles is a map of all roles of the current champion
+	// - LastPatch is the last patch of the range, and PrevPatch the one before it. The changes
+	//   of statistics are those from PrevPatch to LastPatch, so they are patch over patch however
+	//   many patches the range spans. Their quotients are in patches. PrevPatch is empty if
+	//   there is none.
 	Derive(
 		role apb.Role,
 		champions map[uint32]*apb.MatchQuotient,
 		roles map[apb.Role]*apb.MatchQuotient,
 		patches map[string]map[uint32]*apb.MatchQuotient,
+		lastPatch, prevPatch string,
 		id uint32,
-		minPlayRate float64,
+		opts DeriveOptions,
 	) (*apb.MatchAggregate, error)
 }
 
-// NewDeriver constructs a new Deriver.
-func NewDeriver() Deriver {
-	return &deriverImpl{}
+// DeriveOptions are the per-request options of a derivation.
+type DeriveOptions struct {
+	// MinPlayRate is the minimum play rate of a collection entry.
+	MinPlayRate float64
+
+	// PriorStrength is the number of games at the champion's overall win rate added to every
+	// collection entry for its adjusted win rate. 0 leaves adjusted win rates unshrunk.
+	PriorStrength float64
+
+	// GameLengthBucketWidth is the width of game length buckets in minutes, 5 if unset.
+	GameLengthBucketWidth uint32
+	// GameLengthQuantiles, if set, buckets game lengths into this many buckets of about
+	// as many games each instead.
+	GameLengthQuantiles uint32
+
+	// BaselineMinGames and BaselineMinPickRate are the games and pick rate a champion needs to be
+	// part of the baseline statistics are averaged and ranked against. The derived champion is
+	// always part of it.
+	BaselineMinGames    uint32
+	BaselineMinPickRate float64
+
+	// LoadoutSort scores the entries picked for the recommended loadout, pick rate if unset.
+	LoadoutSort apb.CollectionSort
 }
 
-type deriverImpl struct{}
+// NewDeriver constructs a new Deriver whose win and pick rate intervals have the given
+// confidence level, e.g. 0.95.
+func NewDeriver(confidence float64) Deriver {
+	return &deriverImpl{
+		z: confidenceZ(confidence),
+	}
+}
+
+type deriverImpl struct {
+	// z is the standard normal quantile of the confidence level
+	z float64
+}
 
 func (d *deriverImpl) Derive(
 	role apb.Role,
 	champions map[uint32]*apb.MatchQuotient,
 	roles map[apb.Role]*apb.MatchQuotient,
 	patches map[string]map[uint32]*apb.MatchQuotient,
+	lastPatch, prevPatch string,
 	id uint32,
-	minPlayRate float64,
+	opts DeriveOptions,
 ) (*apb.MatchAggregate, error) {
 	// precondition -- champ must exist
 	if champions[id] == nil {
 		return nil, fmt.Errorf("champion %d does not exist in quotient map", id)
 	}
 
-	collections, err := makeMatchAggregateCollections(champions[id], minPlayRate)
+	collections, err := makeMatchAggregateCollections(champions[id], opts, d.z)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing collections: %v", err)
 	}
 
+	statistics := makeMatchAggregateStatistics(champions, id, opts, d.z)
+	if last, prev := patches[lastPatch], patches[prevPatch]; last[id] != nil && prev[id] != nil {
+		setStatisticChanges(
+			statistics,
+			makeMatchAggregateStatistics(last, id, opts, d.z),
+			makeMatchAggregateStatistics(prev, id, opts, d.z),
+		)
+	}
+
 	return &apb.MatchAggregate{
 		Role:        makeMatchAggregateRoles(champions, roles, role, id),
-		Statistics:  makeMatchAggregateStatistics(champions, id),
-		Graphs:      makeMatchAggregateGraphs(champions, patches, id),
+		Statistics:  statistics,
+		Graphs:      makeMatchAggregateGraphs(champions, patches, id, opts, d.z),
 		Collections: collections,
+
+		RecommendedLoadout:    makeLoadout(collections, opts.LoadoutSort),
+		HighestWinRateLoadout: makeLoadout(collections, highestWinRateLoadoutSort),
 	}, nil
 }
 
@@ -109,14 +159,42 @@ type groupedDeltasQuotients struct {
 	damageTaken     groupedDeltaQuotients
 }
 
-func makeMatchAggregateStatistics(quots map[uint32]*apb.MatchQuotient, id uint32) *apb.MatchAggregateStatistics {
+// baselineQuotients gets the champions statistics are compared against: those with at least
+// the minimum games and pick rate of the options, and the champion itself.
+func baselineQuotients(
+	quots map[uint32]*apb.MatchQuotient, id uint32, opts DeriveOptions,
+) map[uint32]*apb.MatchQuotient {
+	if opts.BaselineMinGames == 0 && opts.BaselineMinPickRate == 0 {
+		return quots
+	}
+	ret := map[uint32]*apb.MatchQuotient{}
+	for cid, quot := range quots {
+		if cid != id {
+			if quot.Scalars.Plays < uint64(opts.BaselineMinGames) {
+				continue
+			}
+			if calculatePickRate(quots, cid) < opts.BaselineMinPickRate {
+				continue
+			}
+		}
+		ret[cid] = quot
+	}
+	return ret
+}
+
+// makeMatchAggregateStatistics derives the statistics of a champion, ranked against the
+// baseline of the options. Pick and ban rates are still rates of all games.
+func makeMatchAggregateStatistics(
+	quots map[uint32]*apb.MatchQuotient, id uint32, opts DeriveOptions, z float64,
+) *apb.MatchAggregateStatistics {
 	// grouped quotient aggregates
 	var gs groupedQuotients
 	self := quots[id]
 	selfPick := calculatePickRate(quots, id)
 	selfBan := calculateBanRate(quots, id)
+	baseline := baselineQuotients(quots, id, opts)
 
-	for cid, quot := range quots {
+	for cid, quot := range baseline {
 		// Scalars
 		gs.scalars.winRate = append(gs.scalars.winRate, quot.Scalars.Wins)
 		// TODO(igm): optimize this
@@ -156,11 +234,16 @@ func makeMatchAggregateStatistics(quots map[uint32]*apb.MatchQuotient, id uint32
 		gs.deltas.damageTaken = appendDeltas(gs.deltas.damageTaken, quot.Deltas.DamageTaken)
 	}
 
+	winRate := deriveStatistic(gs.scalars.winRate, self.Scalars.Wins)
+	winRate.Interval = wilsonInterval(self.Scalars.Wins, float64(self.Scalars.Plays), z)
+	pickRate := deriveStatistic(gs.scalars.pickRate, selfPick)
+	pickRate.Interval = wilsonInterval(selfPick, calculateGames(quots), z)
+
 	return &apb.MatchAggregateStatistics{
 		Scalars: &apb.MatchAggregateStatistics_Scalars{
-			WinRate:                  deriveStatistic(gs.scalars.winRate, self.Scalars.Wins),
-			PickRate:                 deriveStatistic(gs.scalars.pickRate, selfPick),
-			BanRate:                  deriveStatistic(gs.scalars.pickRate, selfBan),
+			WinRate:                  winRate,
+			PickRate:                 pickRate,
+			BanRate:                  deriveStatistic(gs.scalars.banRate, selfBan),
 			GamesPlayed:              deriveStatistic(gs.scalars.gamesPlayed, float64(self.Scalars.Plays)),
 			GoldEarned:               deriveStatistic(gs.scalars.goldEarned, self.Scalars.GoldEarned),
 			Kills:                    deriveStatistic(gs.scalars.kills, self.Scalars.Kills),
@@ -194,6 +277,8 @@ func makeMatchAggregateStatistics(quots map[uint32]*apb.MatchQuotient, id uint32
 			WardsPlaced:     deriveDeltaStatistic(gs.deltas.wardsPlaced, self.Deltas.WardsPlaced),
 			DamageTaken:     deriveDeltaStatistic(gs.deltas.damageTaken, self.Deltas.DamageTaken),
 		},
+
+		Metrics: makeMetricStatistics(baseline, id),
 	}
 }
 
@@ -239,34 +324,127 @@ func deriveDeltaStatistic(dqs groupedDeltaQuotients, ds *apb.MatchQuotient_Delta
 	}
 }
 
+// rankEpsilon is the relative difference below which two values are ranked as tied,
+// so floating point noise from summing in a different order does not break ties.
+const rankEpsilon = 1e-9
+
+// valuesEqual checks if two values are equal within rankEpsilon.
+func valuesEqual(a, b float64) bool {
+	return math.Abs(a-b) <= rankEpsilon*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+// deriveStatistic derives the statistic of val among the vals of all champions. Higher values
+// rank first; tied values share the competition rank ("1224") and dense rank ("1223").
+// NaN values, e.g. the rates of champions without games, are left out of the distribution. A NaN
+// val is not ranked among them, so it gets no rank, percentile or z-score.
 func deriveStatistic(vals []float64, val float64) *apb.MatchAggregateStatistics_Statistic {
-	var sum float64
+	var dist []float64
 	for _, v := range vals {
-		sum += v
+		if !math.IsNaN(v) {
+			dist = append(dist, v)
+		}
+	}
+	stat := &apb.MatchAggregateStatistics_Statistic{
+		Value: val,
+	}
+	if len(dist) == 0 {
+		return stat
 	}
-	avg := sum / float64(len(vals))
 
 	// sort desc so we can get the rank
-	sort.Sort(sort.Reverse(sort.Float64Slice(vals)))
-	var rank int
-	for idx, v := range vals {
-		if v == val {
-			rank = idx + 1
-			break
+	sort.Sort(sort.Reverse(sort.Float64Slice(dist)))
+
+	var sum float64
+	var above, tied, distinctAbove int
+	for i, v := range dist {
+		sum += v
+		switch {
+		case valuesEqual(v, val):
+			tied++
+		case v > val:
+			above++
+			if i == 0 || !valuesEqual(v, dist[i-1]) {
+				distinctAbove++
+			}
 		}
 	}
+	n := float64(len(dist))
+	avg := sum / n
+
+	var variance float64
+	for _, v := range dist {
+		variance += (v - avg) * (v - avg)
+	}
+	stddev := math.Sqrt(variance / n)
+
+	stat.Average = avg
+	stat.Median = medianOfSorted(dist)
+	stat.StdDev = stddev
+	stat.Min = dist[len(dist)-1]
+	stat.Max = dist[0]
+	if math.IsNaN(val) {
+		return stat
+	}
+
+	stat.Rank = uint32(above + 1)
+	stat.DenseRank = uint32(distinctAbove + 1)
+	// the share of values below val, counting ties as half below
+	stat.Percentile = (n - float64(above) - float64(tied)/2) / n
+	if stddev > 0 {
+		stat.ZScore = (val - avg) / stddev
+	}
+
+	// change is filled in by setStatisticChanges
+	return stat
+}
 
-	percentile := 1.0 - float64(rank)/float64(len(vals))
+// medianOfSorted gets the median of sorted values, interpolating between the middle two.
+func medianOfSorted(sorted []float64) float64 {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
 
-	// TODO(igm): implement change
-	return &apb.MatchAggregateStatistics_Statistic{
-		Rank:       uint32(rank),
-		Value:      val,
-		Average:    avg,
-		Percentile: percentile,
+// setStatisticChanges sets the change of every statistic to the change of the same statistic
+// from prev to cur, the statistics of two single patches. Rank changes are negative when a
+// champion moves up.
+func setStatisticChanges(stats, cur, prev *apb.MatchAggregateStatistics) {
+	all, now, old := listStatistics(stats), listStatistics(cur), listStatistics(prev)
+	for i, stat := range all {
+		stat.Change = now[i].Value - old[i].Value
+		// an unranked statistic has no rank to change
+		if now[i].Rank == 0 || old[i].Rank == 0 {
+			continue
+		}
+		stat.RankChange = int32(now[i].Rank) - int32(old[i].Rank)
+		stat.PercentileChange = now[i].Percentile - old[i].Percentile
 	}
 }
 
+// listStatistics lists every statistic of a MatchAggregateStatistics in a fixed order.
+func listStatistics(stats *apb.MatchAggregateStatistics) []*apb.MatchAggregateStatistics_Statistic {
+	ss, ds := stats.Scalars, stats.Deltas
+	ret := []*apb.MatchAggregateStatistics_Statistic{
+		ss.WinRate, ss.PickRate, ss.BanRate, ss.GamesPlayed, ss.GoldEarned,
+		ss.Kills, ss.Deaths, ss.Assists, ss.DamageDealt, ss.MinionsKilled,
+		ss.TeamJungleMinionsKilled, ss.EnemyJungleMinionsKilled, ss.StructureDamage, ss.KillingSpree,
+		ss.WardsBought, ss.WardsPlaced, ss.WardsKilled, ss.CrowdControl, ss.FirstBlood,
+		ss.FirstBloodAssist, ss.DoubleKills, ss.TripleKills, ss.Quadrakills, ss.Pentakills,
+	}
+	for _, d := range []*apb.MatchAggregateStatistics_Deltas_Delta{
+		ds.CsDiff, ds.XpDiff, ds.DamageTakenDiff, ds.XpPerMin,
+		ds.GoldPerMin, ds.TowersPerMin, ds.WardsPlaced, ds.DamageTaken,
+	} {
+		ret = append(ret, d.ZeroToTen, d.TenToTwenty, d.TwentyToThirty, d.ThirtyToEnd)
+	}
+	for _, m := range stats.Metrics {
+		ret = append(ret, m.Statistic)
+	}
+	return ret
+}
+
 func appendDeltas(dqs groupedDeltaQuotients, ds *apb.MatchQuotient_Deltas_Delta) groupedDeltaQuotients {
 	return groupedDeltaQuotients{
 		zeroToTen:      append(dqs.zeroToTen, ds.ZeroToTen),
@@ -370,6 +548,7 @@ func deserializeBuild(s string) ([]uint32, error) {
 func makeMatchAggregateGraphs(
 	champions map[uint32]*apb.MatchQuotient,
 	patches map[string]map[uint32]*apb.MatchQuotient, id uint32,
+	opts DeriveOptions, z float64,
 ) *apb.MatchAggregateGraphs {
 	winRate := map[uint32]float64{}
 	pickRate := map[uint32]float64{}
@@ -403,32 +582,30 @@ func makeMatchAggregateGraphs(
 	}
 
 	quot := champions[id]
-	var byGameLength []*apb.MatchAggregateGraphs_ByGameLength
-	for duration, stats := range quot.Durations {
-		byGameLength = append(byGameLength, &apb.MatchAggregateGraphs_ByGameLength{
-			GameLength: &apb.IntRange{
-				Min: duration,
-				Max: duration,
-			},
-			WinRate: stats.Wins,
-		})
-	}
+	byGameLength, roleByGameLength := makeGameLengthGraphs(champions, id, opts, z)
 
 	return &apb.MatchAggregateGraphs{
-		Distribution:   distribution,
-		ByPatch:        byPatch,
-		ByGameLength:   byGameLength,
-		PhysicalDamage: quot.Scalars.PhysicalDamage,
-		MagicDamage:    quot.Scalars.MagicDamage,
-		TrueDamage:     quot.Scalars.TrueDamage,
+		Distribution:     distribution,
+		ByPatch:          byPatch,
+		ByGameLength:     byGameLength,
+		RoleByGameLength: roleByGameLength,
+		PhysicalDamage:   quot.Scalars.PhysicalDamage,
+		MagicDamage:      quot.Scalars.MagicDamage,
+		TrueDamage:       quot.Scalars.TrueDamage,
 	}
 }
 
-func makeMatchAggregateCollections(quot *apb.MatchQuotient, minPlayRate float64) (*apb.MatchAggregateCollections, error) {
+func makeMatchAggregateCollections(
+	quot *apb.MatchQuotient, opts DeriveOptions, z float64,
+) (*apb.MatchAggregateCollections, error) {
+	// the champion's overall win rate is the prior every entry is shrunk toward
+	prior := quot.Scalars.Wins
+
 	// derive runes
 	var runes []*apb.MatchAggregateCollections_RuneSet
-	for rs, rstats := range quot.Runes {
-		if rstats.Plays < minPlayRate {
+	for _, rs := range sortedStringKeys(quot.Runes) {
+		rstats := quot.Runes[rs]
+		if rstats.Plays < opts.MinPlayRate {
 			continue
 		}
 
@@ -439,17 +616,21 @@ func makeMatchAggregateCollections(quot *apb.MatchQuotient, minPlayRate float64)
 			return nil, fmt.Errorf("could not deserialize rune set: %v", err)
 		}
 		runes = append(runes, &apb.MatchAggregateCollections_RuneSet{
-			Runes:      runeSet,
-			PickRate:   rstats.Plays,
-			WinRate:    rstats.Wins,
-			NumMatches: uint32(rstats.PlayCount),
+			Runes:            runeSet,
+			PickRate:         rstats.Plays,
+			WinRate:          rstats.Wins,
+			NumMatches:       uint32(rstats.PlayCount),
+			WinRateInterval:  wilsonInterval(rstats.Wins, float64(rstats.PlayCount), z),
+			PickRateInterval: wilsonInterval(rstats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(rstats, prior, opts.PriorStrength),
 		})
 	}
 
 	// derive masteries
 	var masteries []*apb.MatchAggregateCollections_MasterySet
-	for ms, mstats := range quot.Masteries {
-		if mstats.Plays < minPlayRate {
+	for _, ms := range sortedStringKeys(quot.Masteries) {
+		mstats := quot.Masteries[ms]
+		if mstats.Plays < opts.MinPlayRate {
 			continue
 		}
 
@@ -460,17 +641,21 @@ func makeMatchAggregateCollections(quot *apb.MatchQuotient, minPlayRate float64)
 			return nil, fmt.Errorf("could not deserialize mastery set: %v", err)
 		}
 		masteries = append(masteries, &apb.MatchAggregateCollections_MasterySet{
-			Masteries:  masterySet,
-			PickRate:   mstats.Plays,
-			WinRate:    mstats.Wins,
-			NumMatches: uint32(mstats.PlayCount),
+			Masteries:        masterySet,
+			PickRate:         mstats.Plays,
+			WinRate:          mstats.Wins,
+			NumMatches:       uint32(mstats.PlayCount),
+			WinRateInterval:  wilsonInterval(mstats.Wins, float64(mstats.PlayCount), z),
+			PickRateInterval: wilsonInterval(mstats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(mstats, prior, opts.PriorStrength),
 		})
 	}
 
 	// derive keystones
 	var keystones []*apb.MatchAggregateCollections_Keystone
-	for ks, kstats := range quot.Keystones {
-		if kstats.Plays < minPlayRate {
+	for _, ks := range sortedStringKeys(quot.Keystones) {
+		kstats := quot.Keystones[ks]
+		if kstats.Plays < opts.MinPlayRate {
 			continue
 		}
 
@@ -485,17 +670,21 @@ func makeMatchAggregateCollections(quot *apb.MatchQuotient, minPlayRate float64)
 			continue
 		}
 		keystones = append(keystones, &apb.MatchAggregateCollections_Keystone{
-			Keystone:   keystone,
-			PickRate:   kstats.Plays,
-			WinRate:    kstats.Wins,
-			NumMatches: uint32(kstats.PlayCount),
+			Keystone:         keystone,
+			PickRate:         kstats.Plays,
+			WinRate:          kstats.Wins,
+			NumMatches:       uint32(kstats.PlayCount),
+			WinRateInterval:  wilsonInterval(kstats.Wins, float64(kstats.PlayCount), z),
+			PickRateInterval: wilsonInterval(kstats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(kstats, prior, opts.PriorStrength),
 		})
 	}
 
 	// derive summoners
 	var summonerSpells []*apb.MatchAggregateCollections_SummonerSet
-	for ss, sstats := range quot.Summoners {
-		if sstats.Plays < minPlayRate {
+	for _, ss := range sortedStringKeys(quot.Summoners) {
+		sstats := quot.Summoners[ss]
+		if sstats.Plays < opts.MinPlayRate {
 			continue
 		}
 
@@ -506,34 +695,42 @@ func makeMatchAggregateCollections(quot *apb.MatchQuotient, minPlayRate float64)
 			return nil, fmt.Errorf("could not deserialize summoners: %v", err)
 		}
 		summonerSpells = append(summonerSpells, &apb.MatchAggregateCollections_SummonerSet{
-			Spell1:     spell1,
-			Spell2:     spell2,
-			PickRate:   sstats.Plays,
-			WinRate:    sstats.Wins,
-			NumMatches: uint32(sstats.PlayCount),
+			Spell1:           spell1,
+			Spell2:           spell2,
+			PickRate:         sstats.Plays,
+			WinRate:          sstats.Wins,
+			NumMatches:       uint32(sstats.PlayCount),
+			WinRateInterval:  wilsonInterval(sstats.Wins, float64(sstats.PlayCount), z),
+			PickRateInterval: wilsonInterval(sstats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(sstats, prior, opts.PriorStrength),
 		})
 	}
 
 	// derive trinkets
 	var trinkets []*apb.MatchAggregateCollections_Trinket
-	for trinket, tstats := range quot.Trinkets {
-		if tstats.Plays < minPlayRate {
+	for _, trinket := range sortedUint32Keys(quot.Trinkets) {
+		tstats := quot.Trinkets[trinket]
+		if tstats.Plays < opts.MinPlayRate {
 			continue
 		}
 
 		// tstats is trinket subscalars
 		trinkets = append(trinkets, &apb.MatchAggregateCollections_Trinket{
-			Trinket:    trinket,
-			PickRate:   tstats.Plays,
-			WinRate:    tstats.Wins,
-			NumMatches: uint32(tstats.PlayCount),
+			Trinket:          trinket,
+			PickRate:         tstats.Plays,
+			WinRate:          tstats.Wins,
+			NumMatches:       uint32(tstats.PlayCount),
+			WinRateInterval:  wilsonInterval(tstats.Wins, float64(tstats.PlayCount), z),
+			PickRateInterval: wilsonInterval(tstats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(tstats, prior, opts.PriorStrength),
 		})
 	}
 
 	// derive skill orders
 	var skillOrders []*apb.MatchAggregateCollections_SkillOrder
-	for sos, sostats := range quot.SkillOrders {
-		if sostats.Plays < minPlayRate {
+	for _, sos := range sortedStringKeys(quot.SkillOrders) {
+		sostats := quot.SkillOrders[sos]
+		if sostats.Plays < opts.MinPlayRate {
 			continue
 		}
 
@@ -543,17 +740,23 @@ func makeMatchAggregateCollections(quot *apb.MatchQuotient, minPlayRate float64)
 		}
 		// sostats is skill order subscalars
 		skillOrders = append(skillOrders, &apb.MatchAggregateCollections_SkillOrder{
-			SkillOrder: so,
-			PickRate:   sostats.Plays,
-			WinRate:    sostats.Wins,
-			NumMatches: uint32(sostats.PlayCount),
+			SkillOrder:       so,
+			MaxOrder:         skillMaxOrder(so),
+			Opener:           skillOpener(so),
+			PickRate:         sostats.Plays,
+			WinRate:          sostats.Wins,
+			NumMatches:       uint32(sostats.PlayCount),
+			WinRateInterval:  wilsonInterval(sostats.Wins, float64(sostats.PlayCount), z),
+			PickRateInterval: wilsonInterval(sostats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(sostats, prior, opts.PriorStrength),
 		})
 	}
 
 	// derive starter items
 	var starterItems []*apb.MatchAggregateCollections_Build
-	for sis, sistats := range quot.StarterItems {
-		if sistats.Plays < minPlayRate {
+	for _, sis := range sortedStringKeys(quot.StarterItems) {
+		sistats := quot.StarterItems[sis]
+		if sistats.Plays < opts.MinPlayRate {
 			continue
 		}
 
@@ -563,38 +766,43 @@ func makeMatchAggregateCollections(quot *apb.MatchQuotient, minPlayRate float64)
 		}
 		// sistats is skill order subscalars
 		starterItems = append(starterItems, &apb.MatchAggregateCollections_Build{
-			Build:      si,
-			PickRate:   sistats.Plays,
-			WinRate:    sistats.Wins,
-			NumMatches: uint32(sistats.PlayCount),
+			Build:            si,
+			PickRate:         sistats.Plays,
+			WinRate:          sistats.Wins,
+			NumMatches:       uint32(sistats.PlayCount),
+			WinRateInterval:  wilsonInterval(sistats.Wins, float64(sistats.PlayCount), z),
+			PickRateInterval: wilsonInterval(sistats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(sistats, prior, opts.PriorStrength),
 		})
 	}
 
 	// derive build path
+	// rare paths are kept until grouped, as they still count toward their common prefixes
 	var buildPath []*apb.MatchAggregateCollections_Build
-	for bps, bpstats := range quot.BuildPath {
-		if bpstats.Plays < minPlayRate {
-			continue
-		}
-
+	for _, bps := range sortedStringKeys(quot.BuildPath) {
+		bpstats := quot.BuildPath[bps]
 		bp, err := deserializeBuild(bps)
 		if err != nil {
 			return nil, fmt.Errorf("could not deserialize build path: %v", err)
 		}
 		// bpstats is skill order subscalars
 		buildPath = append(buildPath, &apb.MatchAggregateCollections_Build{
-			Build:      bp,
-			PickRate:   bpstats.Plays,
-			WinRate:    bpstats.Wins,
-			NumMatches: uint32(bpstats.PlayCount),
+			Build:            bp,
+			PickRate:         bpstats.Plays,
+			WinRate:          bpstats.Wins,
+			NumMatches:       uint32(bpstats.PlayCount),
+			WinRateInterval:  wilsonInterval(bpstats.Wins, float64(bpstats.PlayCount), z),
+			PickRateInterval: wilsonInterval(bpstats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(bpstats, prior, opts.PriorStrength),
 		})
 	}
-	buildPath = groupBuildPaths(buildPath)
+	buildPathTree, buildPath := groupBuildPaths(buildPath, opts.MinPlayRate)
 
 	// derive core build list
 	var coreBuildList []*apb.MatchAggregateCollections_Build
-	for cbs, cbstats := range quot.CoreBuildList {
-		if cbstats.Plays < minPlayRate {
+	for _, cbs := range sortedStringKeys(quot.CoreBuildList) {
+		cbstats := quot.CoreBuildList[cbs]
+		if cbstats.Plays < opts.MinPlayRate {
 			continue
 		}
 
@@ -604,10 +812,57 @@ func makeMatchAggregateCollections(quot *apb.MatchQuotient, minPlayRate float64)
 		}
 		// cbstats is skill order subscalars
 		coreBuildList = append(coreBuildList, &apb.MatchAggregateCollections_Build{
-			Build:      cb,
-			PickRate:   cbstats.Plays,
-			WinRate:    cbstats.Wins,
-			NumMatches: uint32(cbstats.PlayCount),
+			Build:            cb,
+			PickRate:         cbstats.Plays,
+			WinRate:          cbstats.Wins,
+			NumMatches:       uint32(cbstats.PlayCount),
+			WinRateInterval:  wilsonInterval(cbstats.Wins, float64(cbstats.PlayCount), z),
+			PickRateInterval: wilsonInterval(cbstats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(cbstats, prior, opts.PriorStrength),
+		})
+	}
+
+	// derive matchups
+	var matchups []*apb.MatchAggregateCollections_Matchup
+	for _, enemy := range sortedUint32Keys(quot.Enemies) {
+		estats := quot.Enemies[enemy]
+		if estats.Plays < opts.MinPlayRate {
+			continue
+		}
+
+		// estats is the subscalars of games against enemy
+		matchups = append(matchups, &apb.MatchAggregateCollections_Matchup{
+			EnemyId:          enemy,
+			PickRate:         estats.Plays,
+			WinRate:          estats.Wins,
+			NumMatches:       uint32(estats.PlayCount),
+			WinRateInterval:  wilsonInterval(estats.Wins, float64(estats.PlayCount), z),
+			PickRateInterval: wilsonInterval(estats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(estats, prior, opts.PriorStrength),
+		})
+	}
+
+	// derive skill max orders
+	var skillMaxOrders []*apb.MatchAggregateCollections_SkillMaxOrder
+	for _, smos := range sortedStringKeys(quot.SkillMaxOrders) {
+		smostats := quot.SkillMaxOrders[smos]
+		if smostats.Plays < opts.MinPlayRate {
+			continue
+		}
+
+		smo, err := deserializeSkillOrder(smos)
+		if err != nil {
+			return nil, fmt.Errorf("could not deserialize skill max order: %v", err)
+		}
+		// smostats is the subscalars of all skill orders with this max order
+		skillMaxOrders = append(skillMaxOrders, &apb.MatchAggregateCollections_SkillMaxOrder{
+			MaxOrder:         smo,
+			PickRate:         smostats.Plays,
+			WinRate:          smostats.Wins,
+			NumMatches:       uint32(smostats.PlayCount),
+			WinRateInterval:  wilsonInterval(smostats.Wins, float64(smostats.PlayCount), z),
+			PickRateInterval: wilsonInterval(smostats.Plays, float64(quot.Scalars.Plays), z),
+			AdjustedWinRate:  shrinkWinRate(smostats, prior, opts.PriorStrength),
 		})
 	}
 
@@ -618,9 +873,12 @@ func makeMatchAggregateCollections(quot *apb.MatchQuotient, minPlayRate float64)
 		SummonerSpells: summonerSpells,
 		Trinkets:       trinkets,
 		SkillOrders:    skillOrders,
+		SkillMaxOrders: skillMaxOrders,
 		StarterItems:   starterItems,
 		BuildPath:      buildPath,
+		BuildPathTree:  buildPathTree,
 		CoreBuildList:  coreBuildList,
+		Matchups:       matchups,
 	}, nil
 }
 
@@ -640,6 +898,15 @@ func calculatePickRate(champions map[uint32]*apb.MatchQuotient, id uint32) float
 	return champPlays / plays
 }
 
+// calculateGames gets the number of games the quotients were summed over, 10 players to a game.
+func calculateGames(champions map[uint32]*apb.MatchQuotient) float64 {
+	var plays float64
+	for _, quot := range champions {
+		plays += float64(quot.Scalars.Plays)
+	}
+	return plays / 10
+}
+
 func calculateBanRate(champions map[uint32]*apb.MatchQuotient, id uint32) float64 {
 	var bans float64
 	var champBans float64
@@ -652,7 +919,13 @@ func calculateBanRate(champions map[uint32]*apb.MatchQuotient, id uint32) float6
 	return champBans / bans
 }
 
-func groupBuildPaths(in []*apb.MatchAggregateCollections_Build) []*apb.MatchAggregateCollections_Build {
-	// TODO(igm)
-	return in
+// shrinkWinRate shrinks the win rate of a collection entry toward prior as if it had
+// strength more games at the prior win rate, so entries with few games stay near the prior.
+// Entries without games, whose win rate is NaN, get the prior.
+func shrinkWinRate(stats *apb.MatchQuotient_Subscalars, prior, strength float64) float64 {
+	n := float64(stats.PlayCount)
+	if n == 0 || n+strength <= 0 {
+		return prior
+	}
+	return (stats.Wins*n + prior*strength) / (n + strength)
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"reflect"
 	"testing"
 
@@ -74,3 +75,262 @@ func TestDeserializeSkillOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestShrinkWinRate(t *testing.T) {
+	for _, test := range []struct {
+		Description string
+		Wins        float64
+		PlayCount   uint64
+		Strength    float64
+		Want        float64
+	}{
+		{
+			Description: "No shrinkage",
+			Wins:        1,
+			PlayCount:   3,
+			Strength:    0,
+			Want:        1,
+		},
+		{
+			Description: "Few games stay near the prior",
+			Wins:        1,
+			PlayCount:   3,
+			Strength:    30,
+			Want:        (3 + 0.5*30) / 33.0,
+		},
+		{
+			Description: "Many games keep their win rate",
+			Wins:        0.6,
+			PlayCount:   9970,
+			Strength:    30,
+			Want:        (0.6*9970 + 0.5*30) / 10000,
+		},
+		{
+			Description: "No games",
+			Strength:    30,
+			Want:        0.5,
+		},
+		{
+			// quotients of entries without games have a NaN win rate
+			Description: "No games with a NaN win rate",
+			Wins:        math.NaN(),
+			Strength:    30,
+			Want:        0.5,
+		},
+		{
+			Description: "No games with a NaN win rate and no shrinkage",
+			Wins:        math.NaN(),
+			Strength:    0,
+			Want:        0.5,
+		},
+	} {
+		stats := &apb.MatchQuotient_Subscalars{Wins: test.Wins, PlayCount: test.PlayCount}
+		if got := shrinkWinRate(stats, 0.5, test.Strength); got != test.Want {
+			t.Errorf("[%s] Got %v - Want %v", test.Description, got, test.Want)
+		}
+	}
+}
+
+func makeTestQuotient(plays uint64, wins float64) *apb.MatchQuotient {
+	delta := &apb.MatchQuotient_Deltas_Delta{}
+	return &apb.MatchQuotient{
+		Scalars: &apb.MatchQuotient_Scalars{Plays: plays, Wins: wins},
+		Deltas: &apb.MatchQuotient_Deltas{
+			CsDiff: delta, XpDiff: delta, DamageTakenDiff: delta, XpPerMin: delta,
+			GoldPerMin: delta, TowersPerMin: delta, WardsPlaced: delta, DamageTaken: delta,
+		},
+	}
+}
+
+func TestSetStatisticChanges(t *testing.T) {
+	cur := makeMatchAggregateStatistics(map[uint32]*apb.MatchQuotient{
+		1: makeTestQuotient(100, 0.6),
+		2: makeTestQuotient(100, 0.5),
+	}, 1, DeriveOptions{}, 1.96)
+	prev := makeMatchAggregateStatistics(map[uint32]*apb.MatchQuotient{
+		1: makeTestQuotient(80, 0.4),
+		2: makeTestQuotient(100, 0.5),
+	}, 1, DeriveOptions{}, 1.96)
+	setStatisticChanges(cur, cur, prev)
+
+	for _, test := range []struct {
+		Description string
+		Stat        *apb.MatchAggregateStatistics_Statistic
+		Change      float64
+		RankChange  int32
+	}{
+		{Description: "Win rate", Stat: cur.Scalars.WinRate, Change: 0.6 - 0.4, RankChange: -1},
+		{Description: "Games played", Stat: cur.Scalars.GamesPlayed, Change: 20, RankChange: -1},
+		{Description: "Kills", Stat: cur.Scalars.Kills, Change: 0, RankChange: 0},
+	} {
+		if math.Abs(test.Stat.Change-test.Change) > 1e-9 {
+			t.Errorf("[%s] Got change %v - Want %v", test.Description, test.Stat.Change, test.Change)
+		}
+		if test.Stat.RankChange != test.RankChange {
+			t.Errorf("[%s] Got rank change %v - Want %v", test.Description, test.Stat.RankChange, test.RankChange)
+		}
+	}
+	if got := cur.Scalars.WinRate.PercentileChange; got != 0.5 {
+		t.Errorf("Got percentile change %v - Want 0.5", got)
+	}
+}
+
+func TestDeriveChangesOverPatchRange(t *testing.T) {
+	// the range is 6.18 through 6.19, so the previous patch is inside it
+	patches := map[string]map[uint32]*apb.MatchQuotient{
+		"6.18": {1: makeTestQuotient(100, 0.4), 2: makeTestQuotient(100, 0.5)},
+		"6.19": {1: makeTestQuotient(100, 0.6), 2: makeTestQuotient(100, 0.5)},
+	}
+	champions := map[uint32]*apb.MatchQuotient{
+		1: makeTestQuotient(200, 0.5),
+		2: makeTestQuotient(200, 0.5),
+	}
+	roles := map[apb.Role]*apb.MatchQuotient{apb.Role_MID: champions[1]}
+
+	agg, err := NewDeriver(0.95).Derive(apb.Role_MID, champions, roles, patches, "6.19", "6.18", 1, DeriveOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	winRate := agg.Statistics.Scalars.WinRate
+	if winRate.Value != 0.5 {
+		t.Errorf("Got win rate %v - Want the range's 0.5", winRate.Value)
+	}
+	// the change is 6.18 to 6.19, not 6.18 to the range containing it
+	if math.Abs(winRate.Change-0.2) > 1e-9 {
+		t.Errorf("Got win rate change %v - Want 0.2", winRate.Change)
+	}
+	if winRate.RankChange != -1 {
+		t.Errorf("Got win rate rank change %v - Want -1", winRate.RankChange)
+	}
+}
+
+func TestMakeMatchAggregateStatisticsBaseline(t *testing.T) {
+	quots := map[uint32]*apb.MatchQuotient{
+		1: makeTestQuotient(100, 0.5),
+		2: makeTestQuotient(100, 0.6),
+		3: makeTestQuotient(5, 1),
+	}
+	for _, test := range []struct {
+		Description string
+		Id          uint32
+		Opts        DeriveOptions
+		Rank        uint32
+		Average     float64
+	}{
+		{Description: "No baseline", Id: 1, Rank: 3, Average: 0.7},
+		{Description: "Off-meta champion excluded", Id: 1, Opts: DeriveOptions{BaselineMinGames: 10}, Rank: 2, Average: 0.55},
+		{Description: "Own champion kept", Id: 3, Opts: DeriveOptions{BaselineMinGames: 10}, Rank: 1, Average: 0.7},
+		// without allies every pick rate is 0, leaving only the champion itself
+		{Description: "Pick rate", Id: 1, Opts: DeriveOptions{BaselineMinPickRate: 0.01}, Rank: 1, Average: 0.5},
+	} {
+		stat := makeMatchAggregateStatistics(quots, test.Id, test.Opts, 1.96).Scalars.WinRate
+		if stat.Value != quots[test.Id].Scalars.Wins {
+			t.Errorf("[%s] Got value %v - Want %v", test.Description, stat.Value, quots[test.Id].Scalars.Wins)
+		}
+		if stat.Rank != test.Rank {
+			t.Errorf("[%s] Got rank %v - Want %v", test.Description, stat.Rank, test.Rank)
+		}
+		if math.Abs(stat.Average-test.Average) > 1e-9 {
+			t.Errorf("[%s] Got average %v - Want %v", test.Description, stat.Average, test.Average)
+		}
+	}
+}
+
+func TestMakeMatchAggregateStatisticsBanRate(t *testing.T) {
+	quots := map[uint32]*apb.MatchQuotient{
+		1: makeTestQuotient(100, 0.5),
+		2: makeTestQuotient(100, 0.5),
+		3: makeTestQuotient(100, 0.5),
+	}
+	// nobody is picked alongside anyone, so every pick rate is 0
+	quots[3].Bans = map[uint32]*apb.MatchQuotient_Subscalars{
+		1: {PlayCount: 30},
+		2: {PlayCount: 60},
+	}
+
+	stat := makeMatchAggregateStatistics(quots, 1, DeriveOptions{}, 1.96).Scalars.BanRate
+	if math.Abs(stat.Value-0.1) > 1e-9 {
+		t.Errorf("Got value %v - Want 0.1", stat.Value)
+	}
+	// ranked against the ban rates 0.2 and 0, not the pick rates
+	if stat.Rank != 2 {
+		t.Errorf("Got rank %v - Want 2", stat.Rank)
+	}
+	if math.Abs(stat.Average-0.1) > 1e-9 {
+		t.Errorf("Got average %v - Want 0.1", stat.Average)
+	}
+}
+
+func TestDeriveStatistic(t *testing.T) {
+	for _, test := range []struct {
+		Description string
+		Vals        []float64
+		Val         float64
+		Want        *apb.MatchAggregateStatistics_Statistic
+	}{
+		{
+			Description: "Distinct values",
+			Vals:        []float64{1, 4, 2, 3},
+			Val:         3,
+			Want: &apb.MatchAggregateStatistics_Statistic{
+				Value: 3, Rank: 2, DenseRank: 2, Average: 2.5, Percentile: 0.625,
+				Median: 2.5, StdDev: math.Sqrt(1.25), Min: 1, Max: 4, ZScore: 0.5 / math.Sqrt(1.25),
+			},
+		},
+		{
+			Description: "Ties share a rank",
+			Vals:        []float64{5, 5, 3, 3, 1},
+			Val:         3,
+			Want: &apb.MatchAggregateStatistics_Statistic{
+				Value: 3, Rank: 3, DenseRank: 2, Average: 3.4, Percentile: 0.4,
+				Median: 3, StdDev: math.Sqrt(2.24), Min: 1, Max: 5, ZScore: -0.4 / math.Sqrt(2.24),
+			},
+		},
+		{
+			Description: "Floating point noise is a tie",
+			Vals:        []float64{0.1 + 0.2, 0.3, 0.5},
+			Val:         0.3,
+			Want: &apb.MatchAggregateStatistics_Statistic{
+				Value: 0.3, Rank: 2, DenseRank: 2, Average: 1.1 / 3, Percentile: 1.0 / 3,
+				Median: 0.3, StdDev: math.Sqrt(0.08 / 9), Min: 0.3, Max: 0.5, ZScore: -1 / math.Sqrt(2),
+			},
+		},
+		{
+			Description: "NaNs are left out",
+			Vals:        []float64{math.NaN(), 2, 2},
+			Val:         2,
+			Want: &apb.MatchAggregateStatistics_Statistic{
+				Value: 2, Rank: 1, DenseRank: 1, Average: 2, Percentile: 0.5,
+				Median: 2, Min: 2, Max: 2,
+			},
+		},
+		{
+			Description: "No values",
+			Val:         2,
+			Want:        &apb.MatchAggregateStatistics_Statistic{Value: 2},
+		},
+	} {
+		got := deriveStatistic(test.Vals, test.Val)
+		if got.Rank != test.Want.Rank || got.DenseRank != test.Want.DenseRank {
+			t.Errorf("[%s] Got rank %d/%d - Want %d/%d",
+				test.Description, got.Rank, got.DenseRank, test.Want.Rank, test.Want.DenseRank)
+		}
+		for _, f := range []struct {
+			Name      string
+			Got, Want float64
+		}{
+			{"value", got.Value, test.Want.Value},
+			{"average", got.Average, test.Want.Average},
+			{"percentile", got.Percentile, test.Want.Percentile},
+			{"median", got.Median, test.Want.Median},
+			{"stddev", got.StdDev, test.Want.StdDev},
+			{"min", got.Min, test.Want.Min},
+			{"max", got.Max, test.Want.Max},
+			{"z-score", got.ZScore, test.Want.ZScore},
+		} {
+			if math.Abs(f.Got-f.Want) > 1e-9 {
+				t.Errorf("[%s] Got %s %v - Want %v", test.Description, f.Name, f.Got, f.Want)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"sort"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// defaultGameLengthBucketWidth is the width of game length buckets, in minutes, if a request
+// asks for neither a width nor quantiles.
+const defaultGameLengthBucketWidth = 5
+
+// gameLengthCount is the games of a single game length.
+type gameLengthCount struct {
+	length uint32
+	plays  uint64
+	wins   float64
+}
+
+// countGameLengths merges the game lengths of quotients, sorted by length.
+func countGameLengths(quots ...*apb.MatchQuotient) []gameLengthCount {
+	counts := map[uint32]*gameLengthCount{}
+	for _, quot := range quots {
+		for length, stats := range quot.Durations {
+			if stats.PlayCount == 0 {
+				continue
+			}
+			c := counts[length]
+			if c == nil {
+				c = &gameLengthCount{length: length}
+				counts[length] = c
+			}
+			c.plays += stats.PlayCount
+			c.wins += stats.Wins * float64(stats.PlayCount)
+		}
+	}
+
+	ret := make([]gameLengthCount, 0, len(counts))
+	for _, c := range counts {
+		ret = append(ret, *c)
+	}
+	sort.Sort(gameLengthsByLength(ret))
+	return ret
+}
+
+// gameLengthBuckets chooses the ranges game lengths are bucketed into. With quantiles, each
+// bucket holds about the same number of games; otherwise buckets are width minutes wide.
+// Only buckets containing games are returned.
+func gameLengthBuckets(counts []gameLengthCount, width, quantiles uint32) []*apb.IntRange {
+	var ret []*apb.IntRange
+	if quantiles > 0 {
+		var total uint64
+		for _, c := range counts {
+			total += c.plays
+		}
+
+		var cur *apb.IntRange
+		var seen uint64
+		for _, c := range counts {
+			if cur == nil {
+				cur = &apb.IntRange{Min: c.length}
+				ret = append(ret, cur)
+			}
+			cur.Max = c.length
+			seen += c.plays
+			// close the bucket once it reaches its share of all games
+			if seen*uint64(quantiles) >= total*uint64(len(ret)) {
+				cur = nil
+			}
+		}
+		return ret
+	}
+
+	if width == 0 {
+		width = defaultGameLengthBucketWidth
+	}
+	for _, c := range counts {
+		min := c.length / width * width
+		if len(ret) == 0 || ret[len(ret)-1].Min != min {
+			ret = append(ret, &apb.IntRange{Min: min, Max: min + width - 1})
+		}
+	}
+	return ret
+}
+
+// bucketGameLengths sums game lengths into buckets.
+func bucketGameLengths(
+	counts []gameLengthCount, buckets []*apb.IntRange, z float64,
+) []*apb.MatchAggregateGraphs_ByGameLength {
+	var ret []*apb.MatchAggregateGraphs_ByGameLength
+	for _, bucket := range buckets {
+		var plays uint64
+		var wins float64
+		for _, c := range counts {
+			if c.length >= bucket.Min && c.length <= bucket.Max {
+				plays += c.plays
+				wins += c.wins
+			}
+		}
+
+		point := &apb.MatchAggregateGraphs_ByGameLength{
+			GameLength: bucket,
+			NumMatches: uint32(plays),
+		}
+		if plays > 0 {
+			point.WinRate = wins / float64(plays)
+		}
+		point.WinRateInterval = wilsonInterval(point.WinRate, float64(plays), z)
+		ret = append(ret, point)
+	}
+	return ret
+}
+
+// makeGameLengthGraphs buckets the game lengths of a champion and of all champions of the role.
+// Buckets are chosen from the role so the two line up.
+func makeGameLengthGraphs(
+	champions map[uint32]*apb.MatchQuotient, id uint32, opts DeriveOptions, z float64,
+) (self, role []*apb.MatchAggregateGraphs_ByGameLength) {
+	var all []*apb.MatchQuotient
+	for _, quot := range champions {
+		all = append(all, quot)
+	}
+	roleCounts := countGameLengths(all...)
+	buckets := gameLengthBuckets(roleCounts, opts.GameLengthBucketWidth, opts.GameLengthQuantiles)
+
+	self = bucketGameLengths(countGameLengths(champions[id]), buckets, z)
+	role = bucketGameLengths(roleCounts, buckets, z)
+	return self, role
+}
+
+type gameLengthsByLength []gameLengthCount
+
+func (g gameLengthsByLength) Len() int           { return len(g) }
+func (g gameLengthsByLength) Less(i, j int) bool { return g[i].length < g[j].length }
+func (g gameLengthsByLength) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func TestGameLengthBuckets(t *testing.T) {
+	counts := []gameLengthCount{
+		{length: 18, plays: 10},
+		{length: 22, plays: 30},
+		{length: 24, plays: 20},
+		{length: 27, plays: 20},
+		{length: 31, plays: 10},
+		{length: 44, plays: 10},
+	}
+	for _, test := range []struct {
+		Description string
+		Width       uint32
+		Quantiles   uint32
+		Want        []*apb.IntRange
+	}{
+		{
+			Description: "Default width",
+			Want:        []*apb.IntRange{{Min: 15, Max: 19}, {Min: 20, Max: 24}, {Min: 25, Max: 29}, {Min: 30, Max: 34}, {Min: 40, Max: 44}},
+		},
+		{
+			Description: "Ten minutes",
+			Width:       10,
+			Want:        []*apb.IntRange{{Min: 10, Max: 19}, {Min: 20, Max: 29}, {Min: 30, Max: 39}, {Min: 40, Max: 49}},
+		},
+		{
+			Description: "Quartiles",
+			Quantiles:   4,
+			Want:        []*apb.IntRange{{Min: 18, Max: 22}, {Min: 24, Max: 24}, {Min: 27, Max: 27}, {Min: 31, Max: 44}},
+		},
+		{
+			Description: "More quantiles than lengths",
+			Quantiles:   10,
+			Want:        []*apb.IntRange{{Min: 18, Max: 18}, {Min: 22, Max: 22}, {Min: 24, Max: 24}, {Min: 27, Max: 27}, {Min: 31, Max: 31}, {Min: 44, Max: 44}},
+		},
+	} {
+		got := gameLengthBuckets(counts, test.Width, test.Quantiles)
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("[%s] Got %v - Want %v", test.Description, got, test.Want)
+		}
+	}
+}
+
+func TestMakeGameLengthGraphs(t *testing.T) {
+	champions := map[uint32]*apb.MatchQuotient{
+		1: {Durations: map[uint32]*apb.MatchQuotient_Subscalars{
+			21: {Wins: 0.5, PlayCount: 10},
+			23: {Wins: 1, PlayCount: 10},
+			36: {Wins: 0.25, PlayCount: 4},
+		}},
+		2: {Durations: map[uint32]*apb.MatchQuotient_Subscalars{
+			22: {Wins: 0, PlayCount: 20},
+			28: {Wins: 0.5, PlayCount: 10},
+			30: {Wins: math.NaN(), PlayCount: 0},
+		}},
+	}
+
+	self, role := makeGameLengthGraphs(champions, 1, DeriveOptions{}, 1.96)
+	for _, test := range []struct {
+		Description string
+		Got         []*apb.MatchAggregateGraphs_ByGameLength
+		Want        []*apb.MatchAggregateGraphs_ByGameLength
+	}{
+		{
+			Description: "Champion",
+			Got:         self,
+			Want: []*apb.MatchAggregateGraphs_ByGameLength{
+				{GameLength: &apb.IntRange{Min: 20, Max: 24}, WinRate: 0.75, NumMatches: 20},
+				{GameLength: &apb.IntRange{Min: 25, Max: 29}, WinRate: 0, NumMatches: 0},
+				{GameLength: &apb.IntRange{Min: 35, Max: 39}, WinRate: 0.25, NumMatches: 4},
+			},
+		},
+		{
+			Description: "Role",
+			Got:         role,
+			Want: []*apb.MatchAggregateGraphs_ByGameLength{
+				{GameLength: &apb.IntRange{Min: 20, Max: 24}, WinRate: 15.0 / 40, NumMatches: 40},
+				{GameLength: &apb.IntRange{Min: 25, Max: 29}, WinRate: 0.5, NumMatches: 10},
+				{GameLength: &apb.IntRange{Min: 35, Max: 39}, WinRate: 0.25, NumMatches: 4},
+			},
+		},
+	} {
+		if len(test.Got) != len(test.Want) {
+			t.Fatalf("[%s] Got %d buckets - Want %d", test.Description, len(test.Got), len(test.Want))
+		}
+		for i, want := range test.Want {
+			got := test.Got[i]
+			if !reflect.DeepEqual(got.GameLength, want.GameLength) || got.NumMatches != want.NumMatches ||
+				math.Abs(got.WinRate-want.WinRate) > 1e-9 {
+				t.Errorf("[%s] Got %v - Want %v", test.Description, got, want)
+			}
+			if got.WinRateInterval == nil || got.WinRateInterval.Lower > got.WinRate || got.WinRateInterval.Upper < got.WinRate {
+				t.Errorf("[%s] Got interval %v around %v", test.Description, got.WinRateInterval, got.WinRate)
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// highestWinRateLoadoutSort scores the highest win rate loadout. The lower bound of the win rate
+// keeps rare entries with a lucky handful of wins from being picked.
+const highestWinRateLoadoutSort = apb.CollectionSort_WIN_RATE_LOWER_BOUND
+
+// makeLoadout picks the best scoring entry of every collection, highest first, so the loadout
+// comes out the same on every call for collections in a deterministic order. The mastery set is
+// the best one containing the keystone, or unset if none of them does. Collections that are
+// empty are left unset. The loadout's number of matches is that of its least played part, as no
+// more matches than that can have played the whole of it.
+func makeLoadout(in *apb.MatchAggregateCollections, key apb.CollectionSort) *apb.MatchAggregate_Loadout {
+	ret := &apb.MatchAggregate_Loadout{}
+	sorter := collectionSorter{key: key}
+
+	// parts are the picked entries, whose least played one supports the whole loadout
+	var parts []collectionEntry
+	pick := func(entries []collectionEntry) collectionEntry {
+		e := sorter.best(entries)
+		if e != nil {
+			parts = append(parts, e)
+		}
+		return e
+	}
+
+	if e := pick(runeSetEntries(in.Runes)); e != nil {
+		ret.Runes = e.(*apb.MatchAggregateCollections_RuneSet)
+	}
+
+	if e := pick(keystoneEntries(in.Keystones)); e != nil {
+		ret.Keystone = e.(*apb.MatchAggregateCollections_Keystone)
+	}
+
+	var masteries []*apb.MatchAggregateCollections_MasterySet
+	for _, e := range in.Masteries {
+		if ret.Keystone == nil || e.Masteries[ret.Keystone.Keystone] > 0 {
+			masteries = append(masteries, e)
+		}
+	}
+	if e := pick(masterySetEntries(masteries)); e != nil {
+		ret.Masteries = e.(*apb.MatchAggregateCollections_MasterySet)
+	}
+
+	if e := pick(summonerSetEntries(in.SummonerSpells)); e != nil {
+		ret.SummonerSpells = e.(*apb.MatchAggregateCollections_SummonerSet)
+	}
+
+	if e := pick(trinketEntries(in.Trinkets)); e != nil {
+		ret.Trinket = e.(*apb.MatchAggregateCollections_Trinket)
+	}
+
+	if e := pick(skillOrderEntries(in.SkillOrders)); e != nil {
+		ret.SkillOrder = e.(*apb.MatchAggregateCollections_SkillOrder)
+	}
+
+	if e := pick(buildEntries(in.StarterItems)); e != nil {
+		ret.StarterItems = e.(*apb.MatchAggregateCollections_Build)
+	}
+
+	if e := pick(buildEntries(in.CoreBuildList)); e != nil {
+		ret.CoreBuild = e.(*apb.MatchAggregateCollections_Build)
+	}
+
+	for i, e := range parts {
+		if i == 0 || e.GetNumMatches() < ret.NumMatches {
+			ret.NumMatches = e.GetNumMatches()
+		}
+	}
+	return ret
+}
+
+// best gets the highest scoring entry, the first of ties, or nil if there are none.
+func (c collectionSorter) best(entries []collectionEntry) collectionEntry {
+	var ret collectionEntry
+	for _, e := range entries {
+		if ret == nil || c.higher(e, ret) {
+			ret = e
+		}
+	}
+	return ret
+}
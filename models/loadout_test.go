@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func TestMakeLoadout(t *testing.T) {
+	in := &apb.MatchAggregateCollections{
+		Keystones: []*apb.MatchAggregateCollections_Keystone{
+			{Keystone: 1, PickRate: 0.7, WinRate: 0.5, NumMatches: 70, WinRateInterval: &apb.Interval{Lower: 0.45}},
+			{Keystone: 2, PickRate: 0.3, WinRate: 0.6, NumMatches: 30, WinRateInterval: &apb.Interval{Lower: 0.5}},
+		},
+		Masteries: []*apb.MatchAggregateCollections_MasterySet{
+			{Masteries: map[uint32]uint32{2: 1}, PickRate: 0.3, WinRate: 0.6, NumMatches: 30},
+			{Masteries: map[uint32]uint32{1: 1, 10: 5}, PickRate: 0.4, WinRate: 0.5, NumMatches: 40},
+			{Masteries: map[uint32]uint32{1: 1, 11: 5}, PickRate: 0.3, WinRate: 0.7, NumMatches: 30},
+		},
+		Trinkets: []*apb.MatchAggregateCollections_Trinket{
+			{Trinket: 3, PickRate: 0.9, WinRate: 0.5, NumMatches: 90, WinRateInterval: &apb.Interval{Lower: 0.4}},
+			{Trinket: 4, PickRate: 0.1, WinRate: 0.9, NumMatches: 10, WinRateInterval: &apb.Interval{Lower: 0.3}},
+		},
+	}
+
+	for _, test := range []struct {
+		key        apb.CollectionSort
+		keystone   uint32
+		mastery    uint32
+		trinket    uint32
+		numMatches uint32
+	}{
+		// the most played mastery set of the most played keystone
+		{apb.CollectionSort_PICK_RATE, 1, 10, 3, 40},
+		// the mastery set with the highest win rate is left out, as it does not contain the keystone
+		{apb.CollectionSort_WIN_RATE, 2, 2, 4, 10},
+		{apb.CollectionSort_WIN_RATE_LOWER_BOUND, 2, 2, 3, 30},
+	} {
+		got := makeLoadout(in, test.key)
+		if got.Keystone.Keystone != test.keystone {
+			t.Errorf("[%v] Got keystone %v - Want %v", test.key, got.Keystone.Keystone, test.keystone)
+		}
+		var mastery uint32
+		for id := range got.Masteries.Masteries {
+			if id != got.Keystone.Keystone || len(got.Masteries.Masteries) == 1 {
+				mastery = id
+			}
+		}
+		if mastery != test.mastery {
+			t.Errorf("[%v] Got mastery set %v - Want one with %v", test.key, got.Masteries.Masteries, test.mastery)
+		}
+		if got.Trinket.Trinket != test.trinket {
+			t.Errorf("[%v] Got trinket %v - Want %v", test.key, got.Trinket.Trinket, test.trinket)
+		}
+		if got.NumMatches != test.numMatches {
+			t.Errorf("[%v] Got %v matches - Want %v", test.key, got.NumMatches, test.numMatches)
+		}
+		if got.Runes != nil || got.CoreBuild != nil {
+			t.Errorf("[%v] Got runes %v and core build %v - Want unset", test.key, got.Runes, got.CoreBuild)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is a size-bounded least-recently-used cache whose entries expire after a TTL.
+// It is safe for concurrent use.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	ll      *list.List
+	entries map[interface{}]*list.Element
+
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key     interface{}
+	value   interface{}
+	expires time.Time
+}
+
+// newLRUCache constructs an lruCache holding at most size entries, each living for ttl.
+// A ttl of zero means entries never expire.
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: map[interface{}]*list.Element{},
+		now:     time.Now,
+	}
+}
+
+// Get gets a value from the cache, marking it as recently used.
+func (c *lruCache) Get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if c.ttl > 0 && c.now().After(entry.expires) {
+		c.removeElement(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+// Add adds a value to the cache, evicting the least recently used entry if full.
+func (c *lruCache) Add(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// RemoveFunc removes all entries whose key matches the predicate and returns the number removed.
+func (c *lruCache) RemoveFunc(fn func(key interface{}) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var removed int
+	for key, el := range c.entries {
+		if fn(key) {
+			c.removeElement(el)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Purge removes all entries.
+func (c *lruCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.entries = map[interface{}]*list.Element{}
+}
+
+// Len returns the number of entries in the cache, including expired ones not yet evicted.
+func (c *lruCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
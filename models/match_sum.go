@@ -2,10 +2,12 @@ package models
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/gocql/gocql"
 	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
 
 	apb "github.com/asunaio/apollo/gen-go/asuna"
 )
@@ -16,6 +18,12 @@ const (
 		WHERE
 			champion_id = ? AND enemy_id = ? AND patch = ? AND
 			tier = ? AND region = ? AND role = ?`
+
+	stmtGetSumsOfTiers = `SELECT tier, match_sum
+		FROM athena_out.match_sums
+		WHERE
+			champion_id = ? AND enemy_id = ? AND patch = ? AND
+			tier IN ? AND region = ? AND role = ?`
 )
 
 const (
@@ -25,157 +33,433 @@ const (
 	prevPatches = 5
 )
 
+// allRoles are the roles summed by SumsOfRoles.
+var allRoles = []apb.Role{
+	apb.Role_TOP,
+	apb.Role_JUNGLE,
+	apb.Role_MID,
+	apb.Role_BOT,
+	apb.Role_SUPPORT,
+}
+
 type MatchSumDAO interface {
 	// Get gets a MatchSum from MatchFilters.
-	Get(f *apb.MatchFilters) (*apb.MatchSum, error)
+	Get(ctx context.Context, f *apb.MatchFilters) (*apb.MatchSum, error)
+
+	// GetMany gets the MatchSums of many MatchFilters in as few queries as possible.
+	// Filters without a MatchSum are absent from the returned map.
+	GetMany(ctx context.Context, filters []*apb.MatchFilters) (map[MatchFiltersKey]*apb.MatchSum, error)
 
 	// Sum sums MatchSums derived from the given filters.
-	Sum(filters []*apb.MatchFilters) (*apb.MatchSum, error)
+	Sum(ctx context.Context, filters []*apb.MatchFilters) (*apb.MatchSum, error)
 
 	// SumsOfChampions gets the sums of champions per patch.
 	SumsOfChampions(
-		patchRange *apb.PatchRange, enemy int32,
+		ctx context.Context, patchRange *apb.PatchRange, enemy int32,
 		tiers *apb.TierRange, region apb.Region, role apb.Role,
 	) (map[uint32]map[string]*apb.MatchSum, error)
 
 	// SumsOfPatches gets the sums of a champion for a range of patches.
 	SumsOfPatches(
-		patchRange *apb.PatchRange, champion uint32, enemy int32,
+		ctx context.Context, patchRange *apb.PatchRange, champion uint32, enemy int32,
 		tiers *apb.TierRange, region apb.Region, role apb.Role,
 	) (map[string]*apb.MatchSum, error)
 
 	// SumOfPatch gets the sum of a champion for a patch.
 	SumOfPatch(
-		patch string, champion uint32, enemy int32,
+		ctx context.Context, patch string, champion uint32, enemy int32,
 		tiers *apb.TierRange, region apb.Region, role apb.Role,
 	) (*apb.MatchSum, error)
 
 	// SumsOfRoles gets the sums of a champion per role for a patch.
 	SumsOfRoles(
-		patch string, champion uint32, enemy int32,
+		ctx context.Context, patch string, champion uint32, enemy int32,
 		tiers *apb.TierRange, region apb.Region,
 	) (map[apb.Role]*apb.MatchSum, error)
 }
 
-// NewMatchSumDAO constructs a new MatchSumDAO.
-func NewMatchSumDAO() MatchSumDAO {
-	return &matchSumDAO{}
+// NewMatchSumDAO constructs a new MatchSumDAO running at most concurrency queries at a time per GetMany or Sum,
+// and fetching at most concurrency sums of patches at a time in SumsOfChampions, SumsOfPatches and SumsOfRoles.
+func NewMatchSumDAO(concurrency int) MatchSumDAO {
+	return &matchSumDAO{
+		concurrency: concurrency,
+		flights:     newFlightGroup(matchSumGetFlightStats),
+	}
 }
 
 type matchSumDAO struct {
 	CQL     *gocql.Session `inject:"t"`
 	Vulgate Vulgate        `inject:"t"`
+
+	concurrency int
+	flights     *flightGroup
 }
 
-func (a *matchSumDAO) Get(f *apb.MatchFilters) (*apb.MatchSum, error) {
+// Get gets a MatchSum from MatchFilters. Concurrent gets of the same filters share one query.
+func (a *matchSumDAO) Get(ctx context.Context, f *apb.MatchFilters) (*apb.MatchSum, error) {
+	rawSum, err, shared := a.flights.Do(NewMatchFiltersKey(f), func() (interface{}, error) {
+		return a.fetch(ctx, f)
+	})
+	if shared && err != nil && ctx.Err() == nil && isContextError(err) {
+		// the caller whose query we joined gave up; we have not, so query ourselves
+		rawSum, err = a.fetch(ctx, f)
+	}
+	if err != nil || rawSum.([]byte) == nil {
+		return nil, err
+	}
+
+	// Every caller unmarshals its own copy as sums are mutated when added
+	var sum apb.MatchSum
+	if err := proto.Unmarshal(rawSum.([]byte), &sum); err != nil {
+		return nil, fmt.Errorf("error unmarshaling sum: %v", err)
+	}
+
+	return &sum, nil
+}
+
+// fetch fetches a serialized MatchSum from Cassandra. It returns nil if no row exists.
+func (a *matchSumDAO) fetch(ctx context.Context, f *apb.MatchFilters) ([]byte, error) {
 	var rawSum []byte
 	if err := a.CQL.Query(
 		stmtGetSum, f.ChampionId, f.EnemyId, f.Patch,
 		f.Tier, int32(f.Region), int32(f.Role),
-	).Scan(&rawSum); err != nil {
+	).WithContext(ctx).Scan(&rawSum); err != nil {
 		if err == gocql.ErrNotFound {
 			return nil, nil
 		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("error fetching sum from Cassandra: %v", err)
 	}
+	if rawSum == nil {
+		// an empty blob is still a row
+		rawSum = []byte{}
+	}
+	return rawSum, nil
+}
 
-	var sum apb.MatchSum
-	if err := proto.Unmarshal(rawSum, &sum); err != nil {
-		return nil, fmt.Errorf("error unmarshaling sum: %v", err)
+// isContextError checks if an error was caused by a context ending.
+func isContextError(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+// tierGroup is a set of filters differing only by tier, which can be fetched in a single query.
+type tierGroup struct {
+	filters *apb.MatchFilters
+	tiers   []int32
+}
+
+// tierGroupKey identifies the query of a tier group, whatever order its tiers are in.
+type tierGroupKey struct {
+	prefix MatchFiltersKey
+	tiers  string
+}
+
+func (g *tierGroup) key() tierGroupKey {
+	prefix := NewMatchFiltersKey(g.filters)
+	prefix.Tier = 0
+	tiers := append([]int32(nil), g.tiers...)
+	sort.Sort(int32Slice(tiers))
+	return tierGroupKey{prefix: prefix, tiers: fmt.Sprint(tiers)}
+}
+
+type int32Slice []int32
+
+func (s int32Slice) Len() int           { return len(s) }
+func (s int32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// groupTiers groups filters into tier groups, in the order their first filter appears.
+func groupTiers(filters []*apb.MatchFilters) []*tierGroup {
+	var groups []*tierGroup
+	byPrefix := map[MatchFiltersKey]*tierGroup{}
+	for _, f := range filters {
+		prefix := NewMatchFiltersKey(f)
+		prefix.Tier = 0
+		group, ok := byPrefix[prefix]
+		if !ok {
+			group = &tierGroup{filters: f}
+			byPrefix[prefix] = group
+			groups = append(groups, group)
+		}
+		group.tiers = append(group.tiers, f.Tier)
 	}
+	return groups
+}
 
-	return &sum, nil
+// GetMany gets the MatchSums of many MatchFilters, querying all tiers of a
+// champion, enemy, patch, region and role at once. Concurrent queries of the
+// same tiers share one query.
+func (a *matchSumDAO) GetMany(
+	ctx context.Context, filters []*apb.MatchFilters,
+) (map[MatchFiltersKey]*apb.MatchSum, error) {
+	return fetchTierGroups(ctx, groupTiers(filters), a.concurrency, func(ctx context.Context, group *tierGroup) (map[MatchFiltersKey]*apb.MatchSum, error) {
+		return getTiers(ctx, a.flights, group, a.fetchTiers)
+	})
 }
 
-// Sum derives a sum from a set of filters.
-func (a *matchSumDAO) Sum(filters []*apb.MatchFilters) (*apb.MatchSum, error) {
-	// Create aggregate sum
-	sum := (*apb.MatchSum)(nil)
+// fetchTierGroups gets the sums of all tier groups with at most concurrency gets in flight.
+// Groups without a row have no sum. Errors are handled as by runParallel.
+func fetchTierGroups(
+	ctx context.Context, groups []*tierGroup, concurrency int,
+	get func(context.Context, *tierGroup) (map[MatchFiltersKey]*apb.MatchSum, error),
+) (map[MatchFiltersKey]*apb.MatchSum, error) {
+	var mu sync.Mutex
+	ret := map[MatchFiltersKey]*apb.MatchSum{}
+	err := runParallel(ctx, len(groups), concurrency, func(ctx context.Context, idx int) error {
+		sums, err := get(ctx, groups[idx])
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for key, sum := range sums {
+			ret[key] = sum
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
 
-	var wg sync.WaitGroup
-	sums := make(chan *apb.MatchSum)
+// getTiers gets the MatchSums of a tier group through flights, so concurrent gets of
+// the same tiers share one fetch.
+func getTiers(
+	ctx context.Context, flights *flightGroup, group *tierGroup,
+	fetch func(context.Context, *tierGroup) (map[int32][]byte, error),
+) (map[MatchFiltersKey]*apb.MatchSum, error) {
+	rawSums, err, shared := flights.Do(group.key(), func() (interface{}, error) {
+		return fetch(ctx, group)
+	})
+	if shared && err != nil && ctx.Err() == nil && isContextError(err) {
+		// the caller whose query we joined gave up; we have not, so query ourselves
+		rawSums, err = fetch(ctx, group)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Every caller unmarshals its own copies as sums are mutated when added
+	ret := map[MatchFiltersKey]*apb.MatchSum{}
+	key := NewMatchFiltersKey(group.filters)
+	for tier, rawSum := range rawSums.(map[int32][]byte) {
+		var sum apb.MatchSum
+		if err := proto.Unmarshal(rawSum, &sum); err != nil {
+			return nil, fmt.Errorf("error unmarshaling sum: %v", err)
+		}
+		key.Tier = tier
+		ret[key] = &sum
+	}
+	return ret, nil
+}
 
-	var fetchErr error
+// fetchTiers fetches the serialized MatchSums of a tier group from Cassandra, by tier.
+func (a *matchSumDAO) fetchTiers(ctx context.Context, group *tierGroup) (map[int32][]byte, error) {
+	f := group.filters
+	iter := a.CQL.Query(
+		stmtGetSumsOfTiers, f.ChampionId, f.EnemyId, f.Patch,
+		group.tiers, int32(f.Region), int32(f.Role),
+	).WithContext(ctx).Iter()
 
-	// Iterate over all filters
-	for _, filter := range filters {
-		wg.Add(1)
-		go func(filter *apb.MatchFilters) {
-			defer wg.Done()
+	ret := map[int32][]byte{}
+	var tier int32
+	var rawSum []byte
+	for iter.Scan(&tier, &rawSum) {
+		ret[tier] = rawSum
+	}
+	if err := iter.Close(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("error fetching sums from Cassandra: %v", err)
+	}
+	return ret, nil
+}
 
-			s, err := a.Get(filter)
-			if err != nil {
-				fetchErr = err
-				return
-			}
-			if s == nil {
-				return
-			}
-			sums <- s
-		}(filter)
+// Sum derives a sum from a set of filters.
+func (a *matchSumDAO) Sum(ctx context.Context, filters []*apb.MatchFilters) (*apb.MatchSum, error) {
+	sums, err := a.GetMany(ctx, filters)
+	if err != nil {
+		return nil, err
 	}
+	return addFetchedSums(orderSums(filters, sums)), nil
+}
 
-	// Close when all are done
-	go func() {
-		wg.Wait()
-		close(sums)
-	}()
+// orderSums lists the sums returned by GetMany in the order of their filters, nil where no row exists.
+func orderSums(filters []*apb.MatchFilters, sums map[MatchFiltersKey]*apb.MatchSum) []*apb.MatchSum {
+	ret := make([]*apb.MatchSum, len(filters))
+	for i, f := range filters {
+		ret[i] = sums[NewMatchFiltersKey(f)]
+	}
+	return ret
+}
 
-	for s := range sums {
+// addFetchedSums adds the sums returned by GetMany, in order, into a new sum, skipping missing ones.
+// The fetched sums are normalized but otherwise left untouched, so they may be shared.
+// It returns nil if no sum exists.
+func addFetchedSums(sums []*apb.MatchSum) *apb.MatchSum {
+	// Create aggregate sum
+	sum := (*apb.MatchSum)(nil)
+	for _, s := range sums {
+		if s == nil {
+			continue
+		}
 		normalizeMatchSum(s)
 		if sum == nil {
-			sum = s
-		} else {
-			sum = addMatchSums(sum, s)
+			sum = &apb.MatchSum{}
+			normalizeMatchSum(sum)
 		}
+		sum = addMatchSums(sum, s)
 	}
+	return sum
+}
 
-	if fetchErr != nil {
-		return nil, fetchErr
+func (m *matchSumDAO) fanOut() int {
+	return m.concurrency
+}
+
+func (m *matchSumDAO) SumsOfChampions(
+	ctx context.Context, patchRange *apb.PatchRange, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[uint32]map[string]*apb.MatchSum, error) {
+	return sumsOfChampions(ctx, m, m.Vulgate, patchRange, enemy, tiers, region, role)
+}
+
+func (m *matchSumDAO) SumsOfPatches(
+	ctx context.Context, patchRange *apb.PatchRange, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[string]*apb.MatchSum, error) {
+	return sumsOfPatches(ctx, m, m.Vulgate, patchRange, champion, enemy, tiers, region, role)
+}
+
+func (m *matchSumDAO) SumOfPatch(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (*apb.MatchSum, error) {
+	return sumOfPatch(ctx, m, m.Vulgate, patch, champion, enemy, tiers, region, role)
+}
+
+func (m *matchSumDAO) SumsOfRoles(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region,
+) (map[apb.Role]*apb.MatchSum, error) {
+	return sumsOfRoles(ctx, m, patch, champion, enemy, tiers, region)
+}
+
+// fanOuter is implemented by MatchSumDAOs which bound how many sums of patches
+// SumsOfChampions, SumsOfPatches and SumsOfRoles fetch at once.
+type fanOuter interface {
+	fanOut() int
+}
+
+// fanOut gets the number of sums of patches dao fetches at once. DAOs wrapping another
+// should inherit the fan-out of the one they wrap; anything else fetches one at a time.
+func fanOut(dao MatchSumDAO) int {
+	if f, ok := dao.(fanOuter); ok {
+		return f.fanOut()
 	}
+	return 1
+}
 
-	// Return sum and error
-	return sum, nil
+// patchSumCall is one dao.SumOfPatch call of a fan-out.
+type patchSumCall struct {
+	patch    string
+	champion uint32
+	role     apb.Role
 }
 
-func (m *matchSumDAO) SumsOfChampions(
+// sumsOfPatchCalls makes all calls to dao.SumOfPatch under a single concurrency budget.
+// Each call writes only to its own index, so results are in call order.
+func sumsOfPatchCalls(
+	ctx context.Context, dao MatchSumDAO, calls []patchSumCall,
+	enemy int32, tiers *apb.TierRange, region apb.Region,
+) ([]*apb.MatchSum, error) {
+	sums := make([]*apb.MatchSum, len(calls))
+	err := runParallel(ctx, len(calls), fanOut(dao), func(ctx context.Context, idx int) error {
+		c := calls[idx]
+		sum, err := dao.SumOfPatch(ctx, c.patch, c.champion, enemy, tiers, region, c.role)
+		sums[idx] = sum
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// sumsOfChampions implements SumsOfChampions on top of dao.SumOfPatch. Every champion and
+// patch is fetched in one fan-out, rather than fanning out per champion.
+func sumsOfChampions(
+	ctx context.Context, dao MatchSumDAO, vulgate Vulgate,
 	patchRange *apb.PatchRange, enemy int32,
 	tiers *apb.TierRange, region apb.Region, role apb.Role,
 ) (map[uint32]map[string]*apb.MatchSum, error) {
+	// TODO(igm): make prev patches configurable
+	patches := vulgate.FindNPreviousPatches(patchRange, prevPatches)
+	var calls []patchSumCall
+	for _, id := range vulgate.GetChampionIDs() {
+		for _, patch := range patches {
+			calls = append(calls, patchSumCall{patch: patch, champion: id, role: role})
+		}
+	}
+	sums, err := sumsOfPatchCalls(ctx, dao, calls, enemy, tiers, region)
+	if err != nil {
+		return nil, err
+	}
+
 	ret := map[uint32]map[string]*apb.MatchSum{}
-	for _, id := range m.Vulgate.GetChampionIDs() {
-		patches, err := m.SumsOfPatches(patchRange, id, enemy, tiers, region, role)
-		if err != nil {
-			return nil, err
+	for i, c := range calls {
+		if ret[c.champion] == nil {
+			ret[c.champion] = map[string]*apb.MatchSum{}
 		}
-		ret[id] = patches
+		ret[c.champion][c.patch] = sums[i]
 	}
 	return ret, nil
 }
 
-func (m *matchSumDAO) SumsOfPatches(
+// sumsOfPatches implements SumsOfPatches on top of dao.SumOfPatch.
+func sumsOfPatches(
+	ctx context.Context, dao MatchSumDAO, vulgate Vulgate,
 	patchRange *apb.PatchRange, champion uint32, enemy int32,
 	tiers *apb.TierRange, region apb.Region, role apb.Role,
 ) (map[string]*apb.MatchSum, error) {
-	ret := map[string]*apb.MatchSum{}
+	var calls []patchSumCall
 	// TODO(igm): make prev patches configurable
-	for _, patch := range m.Vulgate.FindNPreviousPatches(patchRange, prevPatches) {
-		sum, err := m.SumOfPatch(patch, champion, enemy, tiers, region, role)
-		if err != nil {
-			return nil, err
-		}
-		ret[patch] = sum
+	for _, patch := range vulgate.FindNPreviousPatches(patchRange, prevPatches) {
+		calls = append(calls, patchSumCall{patch: patch, champion: champion, role: role})
+	}
+	sums, err := sumsOfPatchCalls(ctx, dao, calls, enemy, tiers, region)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]*apb.MatchSum{}
+	for i, c := range calls {
+		ret[c.patch] = sums[i]
 	}
 	return ret, nil
 }
 
-func (m *matchSumDAO) SumOfPatch(
+// sumOfPatch implements SumOfPatch on top of dao.Sum.
+func sumOfPatch(
+	ctx context.Context, dao MatchSumDAO, vulgate Vulgate,
 	patch string, champion uint32, enemy int32,
 	tiers *apb.TierRange, region apb.Region, role apb.Role,
 ) (*apb.MatchSum, error) {
-	// TODO(igm): cache
+	return dao.Sum(ctx, sumOfPatchFilters(vulgate, patch, champion, enemy, tiers, region, role))
+}
+
+// sumOfPatchFilters builds the filters of the rows summed by SumOfPatch, one per tier.
+func sumOfPatchFilters(
+	vulgate Vulgate,
+	patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) []*apb.MatchFilters {
 	var filters []*apb.MatchFilters
-	for _, tier := range m.Vulgate.FindTiers(tiers) {
+	for _, tier := range vulgate.FindTiers(tiers) {
 		filters = append(filters, &apb.MatchFilters{
 			ChampionId: int32(champion),
 			EnemyId:    enemy,
@@ -185,26 +469,27 @@ func (m *matchSumDAO) SumOfPatch(
 			Role:       role,
 		})
 	}
-	return m.Sum(filters)
+	return filters
 }
 
-func (m *matchSumDAO) SumsOfRoles(
+// sumsOfRoles implements SumsOfRoles on top of dao.SumOfPatch.
+func sumsOfRoles(
+	ctx context.Context, dao MatchSumDAO,
 	patch string, champion uint32, enemy int32,
 	tiers *apb.TierRange, region apb.Region,
 ) (map[apb.Role]*apb.MatchSum, error) {
+	var calls []patchSumCall
+	for _, role := range allRoles {
+		calls = append(calls, patchSumCall{patch: patch, champion: champion, role: role})
+	}
+	sums, err := sumsOfPatchCalls(ctx, dao, calls, enemy, tiers, region)
+	if err != nil {
+		return nil, err
+	}
+
 	ret := map[apb.Role]*apb.MatchSum{}
-	for _, role := range []apb.Role{
-		apb.Role_TOP,
-		apb.Role_JUNGLE,
-		apb.Role_MID,
-		apb.Role_BOT,
-		apb.Role_SUPPORT,
-	} {
-		sum, err := m.SumOfPatch(patch, champion, enemy, tiers, region, role)
-		if err != nil {
-			return nil, err
-		}
-		ret[role] = sum
+	for i, c := range calls {
+		ret[c.role] = sums[i]
 	}
 	return ret, nil
 }
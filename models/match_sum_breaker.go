@@ -0,0 +1,108 @@
+package models
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// NewMatchSumBreaker wraps a MatchSumDAO with a circuit breaker which rejects reads with
+// ErrCircuitOpen once failureRate of the last window reads failed or took longer than slowCall.
+// Reads are let through again after cooldown.
+func NewMatchSumBreaker(
+	backing MatchSumDAO, window int, failureRate float64, slowCall, cooldown time.Duration,
+) MatchSumDAO {
+	return &matchSumBreaker{
+		backing: backing,
+		breaker: newCircuitBreaker(window, failureRate, slowCall, cooldown),
+	}
+}
+
+type matchSumBreaker struct {
+	Vulgate Vulgate `inject:"t"`
+
+	backing MatchSumDAO
+	breaker *circuitBreaker
+}
+
+// call calls fn through the breaker. Calls ended by their context are not held for or
+// against the backend.
+func (m *matchSumBreaker) call(ctx context.Context, fn func() error) error {
+	token, err := m.breaker.Allow()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = fn()
+	outcome := callSucceeded
+	if err != nil {
+		outcome = callFailed
+		if ctx.Err() != nil {
+			outcome = callAbandoned
+		}
+	}
+	m.breaker.Record(token, outcome, time.Since(start))
+	return err
+}
+
+func (m *matchSumBreaker) Get(ctx context.Context, f *apb.MatchFilters) (*apb.MatchSum, error) {
+	var sum *apb.MatchSum
+	err := m.call(ctx, func() (err error) {
+		sum, err = m.backing.Get(ctx, f)
+		return err
+	})
+	return sum, err
+}
+
+func (m *matchSumBreaker) GetMany(
+	ctx context.Context, filters []*apb.MatchFilters,
+) (map[MatchFiltersKey]*apb.MatchSum, error) {
+	var sums map[MatchFiltersKey]*apb.MatchSum
+	err := m.call(ctx, func() (err error) {
+		sums, err = m.backing.GetMany(ctx, filters)
+		return err
+	})
+	return sums, err
+}
+
+func (m *matchSumBreaker) Sum(ctx context.Context, filters []*apb.MatchFilters) (*apb.MatchSum, error) {
+	sums, err := m.GetMany(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	return addFetchedSums(orderSums(filters, sums)), nil
+}
+
+func (m *matchSumBreaker) fanOut() int {
+	return fanOut(m.backing)
+}
+
+func (m *matchSumBreaker) SumsOfChampions(
+	ctx context.Context, patchRange *apb.PatchRange, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[uint32]map[string]*apb.MatchSum, error) {
+	return sumsOfChampions(ctx, m, m.Vulgate, patchRange, enemy, tiers, region, role)
+}
+
+func (m *matchSumBreaker) SumsOfPatches(
+	ctx context.Context, patchRange *apb.PatchRange, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[string]*apb.MatchSum, error) {
+	return sumsOfPatches(ctx, m, m.Vulgate, patchRange, champion, enemy, tiers, region, role)
+}
+
+func (m *matchSumBreaker) SumOfPatch(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (*apb.MatchSum, error) {
+	return sumOfPatch(ctx, m, m.Vulgate, patch, champion, enemy, tiers, region, role)
+}
+
+func (m *matchSumBreaker) SumsOfRoles(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region,
+) (map[apb.Role]*apb.MatchSum, error) {
+	return sumsOfRoles(ctx, m, patch, champion, enemy, tiers, region)
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// MatchSumCache is a MatchSumDAO that caches rows and the sums of patches in memory
+// in front of another MatchSumDAO.
+type MatchSumCache interface {
+	MatchSumDAO
+
+	// Invalidate evicts all cached sums of a patch, e.g. after Athena rewrites it.
+	Invalidate(patch string)
+
+	// Purge evicts all cached sums.
+	Purge()
+
+	// Stats gets the cache's counters.
+	Stats() MatchSumCacheStats
+}
+
+// MatchSumCacheStats contains the counters of a MatchSumCache.
+type MatchSumCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// NewMatchSumCache constructs a new MatchSumCache backed by the given MatchSumDAO.
+// At most size rows and sums are kept, each for at most ttl.
+func NewMatchSumCache(backing MatchSumDAO, size int, ttl time.Duration) MatchSumCache {
+	return &matchSumCache{
+		backing: backing,
+		lru:     newLRUCache(size, ttl),
+	}
+}
+
+type matchSumCache struct {
+	Vulgate Vulgate `inject:"t"`
+
+	backing MatchSumDAO
+	lru     *lruCache
+
+	hits   uint64
+	misses uint64
+}
+
+// sumOfPatchKey is the full filter tuple of a SumOfPatch call.
+type sumOfPatchKey struct {
+	patch    string
+	champion uint32
+	enemy    int32
+	minTier  uint32
+	maxTier  uint32
+	region   apb.Region
+	role     apb.Role
+}
+
+// Get gets a MatchSum from MatchFilters, from the cache if possible.
+// Cached sums are shared between callers and must not be mutated.
+func (m *matchSumCache) Get(ctx context.Context, f *apb.MatchFilters) (*apb.MatchSum, error) {
+	key := NewMatchFiltersKey(f)
+	if cached, ok := m.lru.Get(key); ok {
+		atomic.AddUint64(&m.hits, 1)
+		return cached.(*apb.MatchSum), nil
+	}
+	atomic.AddUint64(&m.misses, 1)
+
+	sum, err := m.backing.Get(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if sum != nil {
+		normalizeMatchSum(sum)
+	}
+	m.lru.Add(key, sum)
+	return sum, nil
+}
+
+// GetMany gets the MatchSums of many MatchFilters, fetching only uncached ones from the backing DAO.
+func (m *matchSumCache) GetMany(
+	ctx context.Context, filters []*apb.MatchFilters,
+) (map[MatchFiltersKey]*apb.MatchSum, error) {
+	ret := map[MatchFiltersKey]*apb.MatchSum{}
+	var misses []*apb.MatchFilters
+	for _, f := range filters {
+		key := NewMatchFiltersKey(f)
+		cached, ok := m.lru.Get(key)
+		if !ok {
+			misses = append(misses, f)
+			continue
+		}
+		if sum := cached.(*apb.MatchSum); sum != nil {
+			ret[key] = sum
+		}
+	}
+	atomic.AddUint64(&m.hits, uint64(len(filters)-len(misses)))
+	atomic.AddUint64(&m.misses, uint64(len(misses)))
+	if len(misses) == 0 {
+		return ret, nil
+	}
+
+	fetched, err := m.backing.GetMany(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range misses {
+		key := NewMatchFiltersKey(f)
+		sum := fetched[key]
+		if sum != nil {
+			normalizeMatchSum(sum)
+			ret[key] = sum
+		}
+		m.lru.Add(key, sum)
+	}
+	return ret, nil
+}
+
+// Sum sums the MatchSums of all filters, getting each from the cache if possible.
+func (m *matchSumCache) Sum(ctx context.Context, filters []*apb.MatchFilters) (*apb.MatchSum, error) {
+	sums, err := m.GetMany(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	return addFetchedSums(orderSums(filters, sums)), nil
+}
+
+func (m *matchSumCache) fanOut() int {
+	return fanOut(m.backing)
+}
+
+func (m *matchSumCache) SumsOfChampions(
+	ctx context.Context, patchRange *apb.PatchRange, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[uint32]map[string]*apb.MatchSum, error) {
+	return sumsOfChampions(ctx, m, m.Vulgate, patchRange, enemy, tiers, region, role)
+}
+
+func (m *matchSumCache) SumsOfPatches(
+	ctx context.Context, patchRange *apb.PatchRange, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[string]*apb.MatchSum, error) {
+	return sumsOfPatches(ctx, m, m.Vulgate, patchRange, champion, enemy, tiers, region, role)
+}
+
+// SumOfPatch gets the sum of a champion for a patch, from the cache if possible.
+// Cached sums are shared between callers and must not be mutated.
+func (m *matchSumCache) SumOfPatch(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (*apb.MatchSum, error) {
+	key := sumOfPatchKey{
+		patch:    patch,
+		champion: champion,
+		enemy:    enemy,
+		region:   region,
+		role:     role,
+	}
+	if tiers != nil {
+		key.minTier = tiers.Min
+		key.maxTier = tiers.Max
+	}
+
+	if cached, ok := m.lru.Get(key); ok {
+		atomic.AddUint64(&m.hits, 1)
+		return cached.(*apb.MatchSum), nil
+	}
+	atomic.AddUint64(&m.misses, 1)
+
+	sum, err := m.backing.SumOfPatch(ctx, patch, champion, enemy, tiers, region, role)
+	if err != nil {
+		return nil, err
+	}
+	// nil sums are cached too, as missing rows are as expensive to look up as present ones
+	m.lru.Add(key, sum)
+	return sum, nil
+}
+
+func (m *matchSumCache) SumsOfRoles(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region,
+) (map[apb.Role]*apb.MatchSum, error) {
+	return sumsOfRoles(ctx, m, patch, champion, enemy, tiers, region)
+}
+
+func (m *matchSumCache) Invalidate(patch string) {
+	m.lru.RemoveFunc(func(key interface{}) bool {
+		switch key := key.(type) {
+		case sumOfPatchKey:
+			return key.patch == patch
+		case MatchFiltersKey:
+			return key.Patch == patch
+		}
+		return false
+	})
+}
+
+func (m *matchSumCache) Purge() {
+	m.lru.Purge()
+}
+
+func (m *matchSumCache) Stats() MatchSumCacheStats {
+	return MatchSumCacheStats{
+		Hits:   atomic.LoadUint64(&m.hits),
+		Misses: atomic.LoadUint64(&m.misses),
+		Size:   m.lru.Len(),
+	}
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// countingMatchSumDAO is a MatchSumDAO which counts calls to SumOfPatch.
+type countingMatchSumDAO struct {
+	MatchSumDAO
+	calls int
+}
+
+func (c *countingMatchSumDAO) SumOfPatch(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (*apb.MatchSum, error) {
+	c.calls++
+	return &apb.MatchSum{Scalars: &apb.MatchSum_Scalars{Plays: uint64(champion)}}, nil
+}
+
+func TestMatchSumCache(t *testing.T) {
+	backing := &countingMatchSumDAO{}
+	cache := NewMatchSumCache(backing, 2, time.Minute).(*matchSumCache)
+	now := time.Unix(0, 0)
+	cache.lru.now = func() time.Time { return now }
+
+	tiers := &apb.TierRange{Min: 0x30, Max: 0x70}
+	get := func(champion uint32) {
+		sum, err := cache.SumOfPatch(context.Background(), "6.18", champion, ANY_CHAMPION, tiers, apb.Region_NA, apb.Role_MID)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if sum.Scalars.Plays != uint64(champion) {
+			t.Errorf("Got sum of %d for champion %d", sum.Scalars.Plays, champion)
+		}
+	}
+
+	for _, test := range []struct {
+		Description string
+		Do          func()
+		WantCalls   int
+	}{
+		{
+			Description: "Miss",
+			Do:          func() { get(1) },
+			WantCalls:   1,
+		},
+		{
+			Description: "Hit",
+			Do:          func() { get(1) },
+			WantCalls:   1,
+		},
+		{
+			Description: "Different tier range misses",
+			Do: func() {
+				cache.SumOfPatch(context.Background(), "6.18", 1, ANY_CHAMPION, &apb.TierRange{Min: 0x10, Max: 0x70}, apb.Region_NA, apb.Role_MID)
+			},
+			WantCalls: 2,
+		},
+		{
+			Description: "Least recently used is evicted",
+			Do:          func() { get(2); get(1) },
+			WantCalls:   4,
+		},
+		{
+			Description: "Expired entries miss",
+			Do:          func() { now = now.Add(2 * time.Minute); get(1) },
+			WantCalls:   5,
+		},
+		{
+			Description: "Invalidated patches miss",
+			Do:          func() { cache.Invalidate("6.18"); get(1) },
+			WantCalls:   6,
+		},
+	} {
+		test.Do()
+		if backing.calls != test.WantCalls {
+			t.Errorf("[%v] Got %d backing calls - Want %d", test.Description, backing.calls, test.WantCalls)
+		}
+	}
+
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 6 {
+		t.Errorf("Got stats %+v - Want 1 hit and 6 misses", stats)
+	}
+}
+
+func (c *countingMatchSumDAO) GetMany(
+	ctx context.Context, filters []*apb.MatchFilters,
+) (map[MatchFiltersKey]*apb.MatchSum, error) {
+	ret := map[MatchFiltersKey]*apb.MatchSum{}
+	for _, f := range filters {
+		c.calls++
+		// odd champions have no rows
+		if f.ChampionId%2 == 0 {
+			ret[NewMatchFiltersKey(f)] = &apb.MatchSum{Scalars: &apb.MatchSum_Scalars{Plays: uint64(f.ChampionId)}}
+		}
+	}
+	return ret, nil
+}
+
+func TestMatchSumCacheGetMany(t *testing.T) {
+	backing := &countingMatchSumDAO{}
+	cache := NewMatchSumCache(backing, 100, time.Minute)
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		Description string
+		Filters     []*apb.MatchFilters
+		WantSums    int
+		WantCalls   int
+	}{
+		{
+			Description: "All misses",
+			Filters:     makeFilters(4),
+			WantSums:    2,
+			WantCalls:   4,
+		},
+		{
+			Description: "Hits, including missing rows",
+			Filters:     makeFilters(4),
+			WantSums:    2,
+			WantCalls:   4,
+		},
+		{
+			Description: "Only misses are fetched",
+			Filters:     makeFilters(6),
+			WantSums:    3,
+			WantCalls:   6,
+		},
+	} {
+		sums, err := cache.GetMany(ctx, test.Filters)
+		if err != nil {
+			t.Errorf("[%v] Unexpected error: %v", test.Description, err)
+			continue
+		}
+		if len(sums) != test.WantSums {
+			t.Errorf("[%v] Got %d sums - Want %d", test.Description, len(sums), test.WantSums)
+		}
+		if backing.calls != test.WantCalls {
+			t.Errorf("[%v] Got %d backing gets - Want %d", test.Description, backing.calls, test.WantCalls)
+		}
+	}
+}
+
+func TestMatchSumCacheSum(t *testing.T) {
+	backing := &countingMatchSumDAO{}
+	cache := NewMatchSumCache(backing, 100, time.Minute)
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		Description string
+		WantCalls   int
+	}{
+		{Description: "Miss", WantCalls: 4},
+		{Description: "Hit", WantCalls: 4},
+	} {
+		sum, err := cache.Sum(ctx, makeFilters(4))
+		if err != nil {
+			t.Errorf("[%v] Unexpected error: %v", test.Description, err)
+			continue
+		}
+		// champions 0 and 2 have rows
+		if sum.Scalars.Plays != 2 {
+			t.Errorf("[%v] Got %d plays - Want 2", test.Description, sum.Scalars.Plays)
+		}
+		if backing.calls != test.WantCalls {
+			t.Errorf("[%v] Got %d backing gets - Want %d", test.Description, backing.calls, test.WantCalls)
+		}
+	}
+}
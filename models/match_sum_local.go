@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/proto"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// LocalStoreExt is the extension of the files making up a local store.
+const LocalStoreExt = ".sums"
+
+// NewLocalMatchSumDAO constructs a MatchSumDAO serving sums from a directory of
+// snapshot files, as written by `apollo dump`. All rows are loaded into memory.
+func NewLocalMatchSumDAO(dir string) (MatchSumDAO, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+LocalStoreExt))
+	if err != nil {
+		return nil, err
+	}
+
+	sums := map[MatchFiltersKey]*apb.MatchSum{}
+	for _, file := range files {
+		if err := loadLocalStoreFile(file, sums); err != nil {
+			return nil, fmt.Errorf("error loading %s: %v", file, err)
+		}
+	}
+	return &memoryMatchSumDAO{sums: sums}, nil
+}
+
+func loadLocalStoreFile(file string, sums map[MatchFiltersKey]*apb.MatchSum) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := NewMatchSumRowReader(f)
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var sum apb.MatchSum
+		if err := proto.Unmarshal(row.RawSum, &sum); err != nil {
+			return fmt.Errorf("error unmarshaling sum: %v", err)
+		}
+		normalizeMatchSum(&sum)
+		sums[NewMatchFiltersKey(row.Filters)] = &sum
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func TestLocalMatchSumDAO(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filter := func(tier int32) *apb.MatchFilters {
+		return &apb.MatchFilters{
+			ChampionId: 64,
+			EnemyId:    ANY_CHAMPION,
+			Patch:      "6.18",
+			Tier:       tier,
+			Region:     apb.Region_NA,
+			Role:       apb.Role_JUNGLE,
+		}
+	}
+
+	f, err := os.Create(filepath.Join(dir, "6.18"+LocalStoreExt))
+	if err != nil {
+		t.Fatalf("Could not create store file: %v", err)
+	}
+	w := NewMatchSumRowWriter(f)
+	for _, tier := range []int32{0x30, 0x40} {
+		raw, err := proto.Marshal(&apb.MatchSum{
+			Scalars: &apb.MatchSum_Scalars{Plays: uint64(tier), Wins: 1},
+		})
+		if err != nil {
+			t.Fatalf("Could not marshal sum: %v", err)
+		}
+		if err := w.Write(&MatchSumRow{Filters: filter(tier), RawSum: raw}); err != nil {
+			t.Fatalf("Could not write row: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Could not flush rows: %v", err)
+	}
+	f.Close()
+
+	dao, err := NewLocalMatchSumDAO(dir)
+	if err != nil {
+		t.Fatalf("Could not load local store: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		Description string
+		Filters     []*apb.MatchFilters
+		WantNil     bool
+		WantPlays   uint64
+	}{
+		{
+			Description: "Single row",
+			Filters:     []*apb.MatchFilters{filter(0x30)},
+			WantPlays:   0x30,
+		},
+		{
+			Description: "Sum of rows",
+			Filters:     []*apb.MatchFilters{filter(0x30), filter(0x40), filter(0x50)},
+			WantPlays:   0x70,
+		},
+		{
+			Description: "Missing row",
+			Filters:     []*apb.MatchFilters{filter(0x50)},
+			WantNil:     true,
+		},
+	} {
+		sum, err := dao.Sum(ctx, test.Filters)
+		if err != nil {
+			t.Errorf("[%v] Unexpected error: %v", test.Description, err)
+			continue
+		}
+		if test.WantNil {
+			if sum != nil {
+				t.Errorf("[%v] Got %v - Want nil", test.Description, sum)
+			}
+			continue
+		}
+		if sum == nil || sum.Scalars.Plays != test.WantPlays {
+			t.Errorf("[%v] Got %v - Want %d plays", test.Description, sum, test.WantPlays)
+		}
+	}
+
+	// summing must not mutate the stored sums
+	if _, err := dao.Sum(ctx, []*apb.MatchFilters{filter(0x30), filter(0x40)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sum, _ := dao.Get(ctx, filter(0x30)); sum.Scalars.Plays != 0x30 {
+		t.Errorf("Got %d plays after summing - Want %d", sum.Scalars.Plays, 0x30)
+	}
+}
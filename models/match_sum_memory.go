@@ -0,0 +1,74 @@
+package models
+
+import (
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// memoryMatchSumDAO is a read-only MatchSumDAO over an in-memory set of rows.
+// Sums are normalized up front and shared between callers, so they are never mutated.
+type memoryMatchSumDAO struct {
+	Vulgate Vulgate `inject:"t"`
+
+	sums map[MatchFiltersKey]*apb.MatchSum
+}
+
+func (m *memoryMatchSumDAO) Get(ctx context.Context, f *apb.MatchFilters) (*apb.MatchSum, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.sums[NewMatchFiltersKey(f)], nil
+}
+
+func (m *memoryMatchSumDAO) GetMany(
+	ctx context.Context, filters []*apb.MatchFilters,
+) (map[MatchFiltersKey]*apb.MatchSum, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ret := map[MatchFiltersKey]*apb.MatchSum{}
+	for _, f := range filters {
+		key := NewMatchFiltersKey(f)
+		if sum, ok := m.sums[key]; ok {
+			ret[key] = sum
+		}
+	}
+	return ret, nil
+}
+
+func (m *memoryMatchSumDAO) Sum(ctx context.Context, filters []*apb.MatchFilters) (*apb.MatchSum, error) {
+	sums, err := m.GetMany(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	return addFetchedSums(orderSums(filters, sums)), nil
+}
+
+func (m *memoryMatchSumDAO) SumsOfChampions(
+	ctx context.Context, patchRange *apb.PatchRange, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[uint32]map[string]*apb.MatchSum, error) {
+	return sumsOfChampions(ctx, m, m.Vulgate, patchRange, enemy, tiers, region, role)
+}
+
+func (m *memoryMatchSumDAO) SumsOfPatches(
+	ctx context.Context, patchRange *apb.PatchRange, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[string]*apb.MatchSum, error) {
+	return sumsOfPatches(ctx, m, m.Vulgate, patchRange, champion, enemy, tiers, region, role)
+}
+
+func (m *memoryMatchSumDAO) SumOfPatch(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (*apb.MatchSum, error) {
+	return sumOfPatch(ctx, m, m.Vulgate, patch, champion, enemy, tiers, region, role)
+}
+
+func (m *memoryMatchSumDAO) SumsOfRoles(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region,
+) (map[apb.Role]*apb.MatchSum, error) {
+	return sumsOfRoles(ctx, m, patch, champion, enemy, tiers, region)
+}
@@ -0,0 +1,412 @@
+package models
+
+import (
+	"errors"
+	"expvar"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// fakeSession serves MatchSums keyed by champion id, in place of Cassandra.
+type fakeSession struct {
+	sums  map[int32]*apb.MatchSum
+	fails map[int32]error
+	delay time.Duration
+	// barrier, if set, holds every get until all of its gets have started
+	barrier *sync.WaitGroup
+
+	calls       int32
+	inFlight    int32
+	maxInFlight int32
+}
+
+func (f *fakeSession) Get(ctx context.Context, filter *apb.MatchFilters) (*apb.MatchSum, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.barrier != nil {
+		f.barrier.Done()
+		f.barrier.Wait()
+	}
+	n := atomic.AddInt32(&f.inFlight, 1)
+	defer atomic.AddInt32(&f.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&f.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&f.maxInFlight, max, n) {
+			break
+		}
+	}
+
+	if err := f.fails[filter.ChampionId]; err != nil {
+		return nil, err
+	}
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return f.sums[filter.ChampionId], nil
+}
+
+// GetTiers gets the sum of a tier group's first filters by Get.
+func (f *fakeSession) GetTiers(ctx context.Context, group *tierGroup) (map[MatchFiltersKey]*apb.MatchSum, error) {
+	sum, err := f.Get(ctx, group.filters)
+	if err != nil || sum == nil {
+		return nil, err
+	}
+	return map[MatchFiltersKey]*apb.MatchSum{NewMatchFiltersKey(group.filters): sum}, nil
+}
+
+func makeFilters(n int) []*apb.MatchFilters {
+	var filters []*apb.MatchFilters
+	for i := 0; i < n; i++ {
+		filters = append(filters, &apb.MatchFilters{ChampionId: int32(i)})
+	}
+	return filters
+}
+
+func TestFetchTierGroups(t *testing.T) {
+	errA := errors.New("a")
+	errB := errors.New("b")
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+
+	for _, test := range []struct {
+		Description string
+		Session     *fakeSession
+		Filters     int
+		Concurrency int
+		Want        []uint64
+		WantErrs    []error
+		MaxCalls    int32
+	}{
+		{
+			Description: "Sums in filter order",
+			Session: &fakeSession{
+				sums: map[int32]*apb.MatchSum{
+					0: {Scalars: &apb.MatchSum_Scalars{Plays: 10}},
+					2: {Scalars: &apb.MatchSum_Scalars{Plays: 30}},
+				},
+			},
+			Filters:     3,
+			Concurrency: 2,
+			Want:        []uint64{10, 0, 30},
+		},
+		{
+			Description: "Concurrency above filter count",
+			Session: &fakeSession{
+				sums: map[int32]*apb.MatchSum{
+					0: {Scalars: &apb.MatchSum_Scalars{Plays: 10}},
+				},
+			},
+			Filters:     1,
+			Concurrency: 8,
+			Want:        []uint64{10},
+		},
+		{
+			Description: "First error cancels the rest",
+			Session: &fakeSession{
+				fails: map[int32]error{0: errA},
+				delay: time.Millisecond,
+			},
+			Filters:     100,
+			Concurrency: 1,
+			WantErrs:    []error{errA},
+			MaxCalls:    2,
+		},
+		{
+			Description: "Simultaneous errors are aggregated",
+			Session: &fakeSession{
+				fails:   map[int32]error{0: errA, 1: errB},
+				barrier: &barrier,
+			},
+			Filters:     2,
+			Concurrency: 2,
+			WantErrs:    []error{errA, errB},
+		},
+	} {
+		filters := makeFilters(test.Filters)
+		sums, err := fetchTierGroups(context.Background(), groupTiers(filters), test.Concurrency, test.Session.GetTiers)
+
+		if test.WantErrs != nil {
+			merr, ok := err.(multiError)
+			if !ok || len(merr) != len(test.WantErrs) {
+				t.Errorf("[%v] Got error %v - Want %v", test.Description, err, test.WantErrs)
+			}
+			if test.MaxCalls > 0 && test.Session.calls > test.MaxCalls {
+				t.Errorf("[%v] Got %d gets - Want at most %d", test.Description, test.Session.calls, test.MaxCalls)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%v] Unexpected error: %v", test.Description, err)
+			continue
+		}
+		if max := int(test.Session.maxInFlight); max > test.Concurrency {
+			t.Errorf("[%v] Got %d gets in flight - Want at most %d", test.Description, max, test.Concurrency)
+		}
+		got := orderSums(filters, sums)
+		for i, want := range test.Want {
+			var plays uint64
+			if got[i] != nil {
+				plays = got[i].Scalars.Plays
+			}
+			if plays != want {
+				t.Errorf("[%v] Got %d plays for filter %d - Want %d", test.Description, plays, i, want)
+			}
+		}
+	}
+}
+
+func TestFetchTierGroupsConcurrencyLimit(t *testing.T) {
+	session := &fakeSession{delay: time.Millisecond}
+	if _, err := fetchTierGroups(context.Background(), groupTiers(makeFilters(50)), 4, session.GetTiers); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if session.maxInFlight != 4 {
+		t.Errorf("Got %d gets in flight - Want 4", session.maxInFlight)
+	}
+}
+
+func TestFetchTierGroupsCanceled(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &fakeSession{delay: time.Hour}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var err error
+	go func() {
+		defer wg.Done()
+		_, err = fetchTierGroups(ctx, groupTiers(makeFilters(20)), 4, session.GetTiers)
+	}()
+	cancel()
+	wg.Wait()
+
+	if err != context.Canceled {
+		t.Errorf("Got error %v - Want %v", err, context.Canceled)
+	}
+
+	// give exiting goroutines a chance to be reaped
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Leaked %d goroutines", after-before)
+	}
+}
+
+// waitCollapsed waits until n calls of stats' flight group are collapsed into another.
+func waitCollapsed(stats *expvar.Map, n int64) {
+	for stats.Get("collapsed") == nil || stats.Get("collapsed").(*expvar.Int).Value() < n {
+		runtime.Gosched()
+	}
+}
+
+func TestGetTiersShared(t *testing.T) {
+	stats := new(expvar.Map).Init()
+	flights := newFlightGroup(stats)
+
+	const callers = 5
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context, group *tierGroup) (map[int32][]byte, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		raw, _ := proto.Marshal(&apb.MatchSum{Scalars: &apb.MatchSum_Scalars{Plays: 10}})
+		return map[int32][]byte{1: raw, 2: raw}, nil
+	}
+
+	var done sync.WaitGroup
+	done.Add(callers)
+	results := make([]map[MatchFiltersKey]*apb.MatchSum, callers)
+	for i := 0; i < callers; i++ {
+		// the same tiers in any order share a query
+		tiers := []int32{1, 2}
+		if i%2 == 1 {
+			tiers = []int32{2, 1}
+		}
+		go func(i int, group *tierGroup) {
+			defer done.Done()
+			results[i], _ = getTiers(context.Background(), flights, group, fetch)
+		}(i, &tierGroup{filters: &apb.MatchFilters{ChampionId: 1, Patch: "6.18"}, tiers: tiers})
+	}
+	waitCollapsed(stats, callers-1)
+	close(release)
+	done.Wait()
+
+	if fetches != 1 {
+		t.Errorf("Got %d fetches - Want 1", fetches)
+	}
+	key := NewMatchFiltersKey(&apb.MatchFilters{ChampionId: 1, Patch: "6.18", Tier: 2})
+	seen := map[*apb.MatchSum]bool{}
+	for i, sums := range results {
+		sum := sums[key]
+		if sum == nil || sum.Scalars.Plays != 10 {
+			t.Errorf("Got sum %v for caller %d - Want 10 plays", sum, i)
+			continue
+		}
+		if seen[sum] {
+			t.Errorf("Got a sum shared by caller %d - Want its own copy", i)
+		}
+		seen[sum] = true
+	}
+}
+
+func TestGetTiersJoinedCanceled(t *testing.T) {
+	stats := new(expvar.Map).Init()
+	flights := newFlightGroup(stats)
+	group := &tierGroup{filters: &apb.MatchFilters{ChampionId: 1}, tiers: []int32{1}}
+
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context, group *tierGroup) (map[int32][]byte, error) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			<-release
+			return nil, context.Canceled
+		}
+		raw, _ := proto.Marshal(&apb.MatchSum{})
+		return map[int32][]byte{1: raw}, nil
+	}
+
+	leader := make(chan struct{})
+	go func() {
+		defer close(leader)
+		getTiers(context.Background(), flights, group, fetch)
+	}()
+	for atomic.LoadInt32(&fetches) == 0 {
+		runtime.Gosched()
+	}
+
+	joined := make(chan map[MatchFiltersKey]*apb.MatchSum)
+	go func() {
+		sums, err := getTiers(context.Background(), flights, group, fetch)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		joined <- sums
+	}()
+	waitCollapsed(stats, 1)
+	close(release)
+	<-leader
+
+	if sums := <-joined; len(sums) != 1 {
+		t.Errorf("Got %d sums after the joined fetch was canceled - Want 1", len(sums))
+	}
+	if fetches != 2 {
+		t.Errorf("Got %d fetches - Want 2", fetches)
+	}
+}
+
+// slowMatchSumDAO is a MatchSumDAO whose sums of patches take delay to fetch.
+type slowMatchSumDAO struct {
+	MatchSumDAO
+	vulgate     Vulgate
+	delay       time.Duration
+	concurrency int
+
+	inFlight    int32
+	maxInFlight int32
+}
+
+func (s *slowMatchSumDAO) fanOut() int {
+	return s.concurrency
+}
+
+func (s *slowMatchSumDAO) SumOfPatch(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (*apb.MatchSum, error) {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&s.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&s.maxInFlight, max, n) {
+			break
+		}
+	}
+	time.Sleep(s.delay)
+	return &apb.MatchSum{
+		Scalars: &apb.MatchSum_Scalars{
+			Plays: uint64(champion)*1000 + uint64(role),
+			Wins:  uint64(len(patch)),
+		},
+	}, nil
+}
+
+func (s *slowMatchSumDAO) SumsOfChampions(
+	ctx context.Context, patchRange *apb.PatchRange, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[uint32]map[string]*apb.MatchSum, error) {
+	return sumsOfChampions(ctx, s, s.vulgate, patchRange, enemy, tiers, region, role)
+}
+
+func (s *slowMatchSumDAO) SumsOfRoles(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region,
+) (map[apb.Role]*apb.MatchSum, error) {
+	return sumsOfRoles(ctx, s, patch, champion, enemy, tiers, region)
+}
+
+func TestSumsOfChampionsParallel(t *testing.T) {
+	patches := &apb.PatchRange{Min: "6.18", Max: "6.18"}
+	sequential := &slowMatchSumDAO{vulgate: newTestVulgate(), concurrency: 1}
+	want, err := sequential.SumsOfChampions(context.Background(), patches, ANY_CHAMPION, nil, apb.Region_NA, apb.Role_MID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	parallel := &slowMatchSumDAO{vulgate: newTestVulgate(), delay: time.Millisecond, concurrency: 4}
+	got, err := parallel.SumsOfChampions(context.Background(), patches, ANY_CHAMPION, nil, apb.Region_NA, apb.Role_MID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Got %d champions - Want 3", len(got))
+	}
+	for id, wantPatches := range want {
+		if len(got[id]) != len(wantPatches) {
+			t.Errorf("[%d] Got %d patches - Want %d", id, len(got[id]), len(wantPatches))
+		}
+		for patch, sum := range wantPatches {
+			if g := got[id][patch]; g == nil || g.Scalars.Plays != sum.Scalars.Plays {
+				t.Errorf("[%d %s] Got %v - Want %v", id, patch, g, sum)
+			}
+		}
+	}
+	if parallel.maxInFlight != 4 {
+		t.Errorf("Got %d sums in flight - Want 4", parallel.maxInFlight)
+	}
+
+	roles, err := parallel.SumsOfRoles(context.Background(), "6.18", 2, ANY_CHAMPION, nil, apb.Region_NA)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, role := range allRoles {
+		if want := 2000 + uint64(role); roles[role].Scalars.Plays != want {
+			t.Errorf("[%v] Got %d - Want %d", role, roles[role].Scalars.Plays, want)
+		}
+	}
+}
+
+func benchmarkSumsOfChampions(b *testing.B, concurrency int) {
+	dao := &slowMatchSumDAO{vulgate: newTestVulgate(), delay: time.Millisecond, concurrency: concurrency}
+	patches := &apb.PatchRange{Min: "6.18", Max: "6.18"}
+	for i := 0; i < b.N; i++ {
+		if _, err := dao.SumsOfChampions(
+			context.Background(), patches, ANY_CHAMPION, nil, apb.Region_NA, apb.Role_MID); err != nil {
+			b.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func BenchmarkSumsOfChampionsSequential(b *testing.B) { benchmarkSumsOfChampions(b, 1) }
+func BenchmarkSumsOfChampionsParallel(b *testing.B)   { benchmarkSumsOfChampions(b, 16) }
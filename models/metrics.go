@@ -0,0 +1,115 @@
+package models
+
+import (
+	"math"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// derivedMetric is a metric derived from the per game averages and game lengths of a quotient,
+// so every client computes it the same way.
+type derivedMetric struct {
+	// name identifies the metric
+	name string
+
+	// label, unit and decimals are how the metric is displayed
+	label    string
+	unit     string
+	decimals uint32
+
+	// value derives the metric from a quotient and its average game length in minutes.
+	// It is NaN if the metric cannot be derived, e.g. without games.
+	value func(quot *apb.MatchQuotient, minutes float64) float64
+}
+
+// derivedMetrics is the registry of derived metrics, in the order they are returned.
+//
+// Kill participation and damage share need the kills and damage of the whole team, which
+// match sums do not have, so they cannot be derived here.
+var derivedMetrics = []derivedMetric{
+	{
+		name: "kda", label: "KDA", decimals: 2,
+		value: func(quot *apb.MatchQuotient, _ float64) float64 {
+			s := quot.Scalars
+			if s.Plays == 0 {
+				return math.NaN()
+			}
+			// deathless champions are divided by a single death, as is conventional
+			return (s.Kills + s.Assists) / math.Max(s.Deaths, 1)
+		},
+	},
+	{
+		name: "cs_per_min", label: "CS", unit: "/min", decimals: 1,
+		value: func(quot *apb.MatchQuotient, minutes float64) float64 {
+			s := quot.Scalars
+			return perMinute(s.MinionsKilled+s.TeamJungleMinionsKilled+s.EnemyJungleMinionsKilled, minutes)
+		},
+	},
+	{
+		name: "gold_per_min", label: "Gold", unit: "/min", decimals: 0,
+		value: func(quot *apb.MatchQuotient, minutes float64) float64 {
+			return perMinute(quot.Scalars.GoldEarned, minutes)
+		},
+	},
+	{
+		name: "damage_per_min", label: "Damage", unit: "/min", decimals: 0,
+		value: func(quot *apb.MatchQuotient, minutes float64) float64 {
+			return perMinute(quot.Scalars.DamageDealt, minutes)
+		},
+	},
+	{
+		// vision score is not summed, so wards placed and killed stand in for it
+		name: "wards_per_min", label: "Wards placed and killed", unit: "/min", decimals: 2,
+		value: func(quot *apb.MatchQuotient, minutes float64) float64 {
+			return perMinute(quot.Scalars.WardsPlaced+quot.Scalars.WardsKilled, minutes)
+		},
+	},
+}
+
+// perMinute divides a per game average by the average game length, NaN without games.
+func perMinute(val, minutes float64) float64 {
+	if minutes == 0 {
+		return math.NaN()
+	}
+	return val / minutes
+}
+
+// averageGameLength is the average game length of a quotient in minutes, 0 without games.
+func averageGameLength(quot *apb.MatchQuotient) float64 {
+	var minutes float64
+	var plays uint64
+	for length, stats := range quot.Durations {
+		minutes += float64(length) * float64(stats.PlayCount)
+		plays += stats.PlayCount
+	}
+	if plays == 0 {
+		return 0
+	}
+	return minutes / float64(plays)
+}
+
+// makeMetricStatistics derives every registered metric for every champion, and ranks the
+// champion's among them.
+func makeMetricStatistics(quots map[uint32]*apb.MatchQuotient, id uint32) []*apb.MatchAggregateStatistics_Metric {
+	vals := make([][]float64, len(derivedMetrics))
+	for _, quot := range quots {
+		minutes := averageGameLength(quot)
+		for i, metric := range derivedMetrics {
+			vals[i] = append(vals[i], metric.value(quot, minutes))
+		}
+	}
+
+	self := quots[id]
+	minutes := averageGameLength(self)
+	ret := make([]*apb.MatchAggregateStatistics_Metric, len(derivedMetrics))
+	for i, metric := range derivedMetrics {
+		ret[i] = &apb.MatchAggregateStatistics_Metric{
+			Name:      metric.name,
+			Label:     metric.label,
+			Unit:      metric.unit,
+			Decimals:  metric.decimals,
+			Statistic: deriveStatistic(vals[i], metric.value(self, minutes)),
+		}
+	}
+	return ret
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// makeTestMetricQuotient makes a quotient the way aggregations do, from a sum.
+func makeTestMetricQuotient(scalars *apb.MatchSum_Scalars, durations map[uint32]*apb.MatchSum_Subscalars) *apb.MatchQuotient {
+	sum := &apb.MatchSum{Scalars: scalars, Durations: durations}
+	normalizeMatchSum(sum)
+	return makeQuotient(sum, newTestVulgate())
+}
+
+func TestMakeMetricStatistics(t *testing.T) {
+	quots := map[uint32]*apb.MatchQuotient{
+		1: makeTestMetricQuotient(&apb.MatchSum_Scalars{
+			Plays: 10, Kills: 60, Deaths: 30, Assists: 90, GoldEarned: 120000, MinionsKilled: 1800,
+			TeamJungleMinionsKilled: 100, EnemyJungleMinionsKilled: 100, DamageDealt: 300000,
+			WardsPlaced: 100, WardsKilled: 20,
+		}, map[uint32]*apb.MatchSum_Subscalars{
+			20: {Plays: 5},
+			40: {Plays: 5},
+		}),
+		2: makeTestMetricQuotient(&apb.MatchSum_Scalars{
+			Plays: 10, Kills: 20, Deaths: 0, Assists: 40, GoldEarned: 90000, MinionsKilled: 900,
+			DamageDealt: 150000, WardsPlaced: 300, WardsKilled: 60,
+		}, map[uint32]*apb.MatchSum_Subscalars{
+			30: {Plays: 10},
+		}),
+		// no games, so no metric can be derived
+		3: makeTestMetricQuotient(&apb.MatchSum_Scalars{}, nil),
+	}
+
+	got := makeMetricStatistics(quots, 1)
+	if len(got) != len(derivedMetrics) {
+		t.Fatalf("Got %v metrics - Want %v", len(got), len(derivedMetrics))
+	}
+
+	for i, test := range []struct {
+		name    string
+		value   float64
+		average float64
+		rank    uint32
+	}{
+		{"kda", 5, 5.5, 2},
+		{"cs_per_min", 200.0 / 30, (200.0/30 + 3) / 2, 1},
+		{"gold_per_min", 400, 350, 1},
+		{"damage_per_min", 1000, 750, 1},
+		{"wards_per_min", 0.4, 0.8, 2},
+	} {
+		metric := got[i]
+		if metric.Name != test.name {
+			t.Errorf("[%v] Got name %v - Want %v", test.name, metric.Name, test.name)
+		}
+		stat := metric.Statistic
+		if math.Abs(stat.Value-test.value) > 1e-9 {
+			t.Errorf("[%v] Got value %v - Want %v", test.name, stat.Value, test.value)
+		}
+		if math.Abs(stat.Average-test.average) > 1e-9 {
+			t.Errorf("[%v] Got average %v - Want %v", test.name, stat.Average, test.average)
+		}
+		if stat.Rank != test.rank {
+			t.Errorf("[%v] Got rank %v - Want %v", test.name, stat.Rank, test.rank)
+		}
+	}
+}
+
+func TestMakeMetricStatisticsWithoutGames(t *testing.T) {
+	quots := map[uint32]*apb.MatchQuotient{
+		1: makeTestMetricQuotient(&apb.MatchSum_Scalars{
+			Plays: 10, Kills: 60, Deaths: 30, Assists: 90,
+		}, map[uint32]*apb.MatchSum_Subscalars{
+			30: {Plays: 10},
+		}),
+		2: makeTestMetricQuotient(&apb.MatchSum_Scalars{}, nil),
+	}
+
+	for _, metric := range makeMetricStatistics(quots, 2) {
+		stat := metric.Statistic
+		if !math.IsNaN(stat.Value) {
+			t.Errorf("[%v] Got value %v - Want NaN", metric.Name, stat.Value)
+		}
+		if stat.Rank != 0 || stat.DenseRank != 0 || stat.Percentile != 0 || stat.ZScore != 0 {
+			t.Errorf("[%v] Got rank %v, dense rank %v, percentile %v, z-score %v - Want none",
+				metric.Name, stat.Rank, stat.DenseRank, stat.Percentile, stat.ZScore)
+		}
+	}
+}
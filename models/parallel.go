@@ -0,0 +1,85 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// runParallel calls fn for every index in [0, n) with at most concurrency calls in flight.
+// The first error cancels the context passed to all remaining calls and stops new ones
+// from starting. If ctx ends, its error is returned; otherwise every error that is not
+// a result of that cancellation is returned in a multiError.
+func runParallel(
+	ctx context.Context, n, concurrency int,
+	fn func(ctx context.Context, idx int) error,
+) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > n {
+		concurrency = n
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, n)
+	work := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				if err := fn(runCtx, idx); err != nil {
+					errs[idx] = err
+					cancel()
+				}
+			}
+		}()
+	}
+
+	// Stop handing out work once anything fails
+feed:
+	for idx := 0; idx < n; idx++ {
+		select {
+		case work <- idx:
+		case <-runCtx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var merr multiError
+	for _, err := range errs {
+		if err != nil && err != context.Canceled {
+			merr = append(merr, err)
+		}
+	}
+	if len(merr) > 0 {
+		return merr
+	}
+	return nil
+}
+
+// multiError is a list of errors occurring in parallel.
+type multiError []error
+
+func (m multiError) Error() string {
+	if len(m) == 1 {
+		return m[0].Error()
+	}
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(m), strings.Join(msgs, "; "))
+}
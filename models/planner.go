@@ -0,0 +1,78 @@
+package models
+
+import (
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// queryPlan is a deduplicated set of match_sums rows to fetch.
+type queryPlan struct {
+	filters []*apb.MatchFilters
+	keys    map[MatchFiltersKey]bool
+}
+
+func newQueryPlan() *queryPlan {
+	return &queryPlan{keys: map[MatchFiltersKey]bool{}}
+}
+
+// add adds rows to the plan, skipping rows already in it.
+func (p *queryPlan) add(filters ...*apb.MatchFilters) {
+	for _, f := range filters {
+		key := NewMatchFiltersKey(f)
+		if p.keys[key] {
+			continue
+		}
+		p.keys[key] = true
+		p.filters = append(p.filters, f)
+	}
+}
+
+// planAggregate enumerates every row read by an aggregation. It must mirror the reads made
+// by aggregatorImpl.aggregate through SumsOfChampions, SumOfPatch and SumsOfRoles.
+func planAggregate(
+	vulgate Vulgate,
+	championId uint32,
+	enemyChampionId int32,
+	patch *apb.PatchRange,
+	tier *apb.TierRange,
+	region apb.Region,
+	role apb.Role,
+) *queryPlan {
+	plan := newQueryPlan()
+
+	// SumsOfChampions
+	patches := vulgate.FindNPreviousPatches(patch, prevPatches)
+	for _, id := range vulgate.GetChampionIDs() {
+		for _, p := range patches {
+			plan.add(sumOfPatchFilters(vulgate, p, id, enemyChampionId, tier, region, role)...)
+		}
+	}
+
+	// SumOfPatch of patches in range the champion sums did not cover
+	for _, p := range vulgate.FindPatches(patch) {
+		plan.add(sumOfPatchFilters(vulgate, p, championId, enemyChampionId, tier, region, role)...)
+	}
+
+	// SumsOfRoles
+	if patch != nil {
+		for _, r := range allRoles {
+			plan.add(sumOfPatchFilters(vulgate, patch.Max, championId, enemyChampionId, tier, region, r)...)
+		}
+	}
+
+	return plan
+}
+
+// fetch fetches all rows of the plan in one batched pass, returning a MatchSumDAO
+// which serves them from memory.
+func (p *queryPlan) fetch(ctx context.Context, dao MatchSumDAO, vulgate Vulgate) (MatchSumDAO, error) {
+	sums, err := dao.GetMany(ctx, p.filters)
+	if err != nil {
+		return nil, err
+	}
+	for _, sum := range sums {
+		normalizeMatchSum(sum)
+	}
+	return &memoryMatchSumDAO{Vulgate: vulgate, sums: sums}, nil
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// recordingMatchSumDAO records the filters of every Get.
+type recordingMatchSumDAO struct {
+	Vulgate Vulgate
+	gets    map[MatchFiltersKey]int
+}
+
+func (m *recordingMatchSumDAO) Get(ctx context.Context, f *apb.MatchFilters) (*apb.MatchSum, error) {
+	m.gets[NewMatchFiltersKey(f)]++
+	return nil, nil
+}
+
+func (m *recordingMatchSumDAO) GetMany(
+	ctx context.Context, filters []*apb.MatchFilters,
+) (map[MatchFiltersKey]*apb.MatchSum, error) {
+	for _, f := range filters {
+		m.Get(ctx, f)
+	}
+	return map[MatchFiltersKey]*apb.MatchSum{}, nil
+}
+
+func (m *recordingMatchSumDAO) Sum(ctx context.Context, filters []*apb.MatchFilters) (*apb.MatchSum, error) {
+	sums, err := m.GetMany(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	return addFetchedSums(orderSums(filters, sums)), nil
+}
+
+func (m *recordingMatchSumDAO) SumsOfChampions(
+	ctx context.Context, patchRange *apb.PatchRange, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[uint32]map[string]*apb.MatchSum, error) {
+	return sumsOfChampions(ctx, m, m.Vulgate, patchRange, enemy, tiers, region, role)
+}
+
+func (m *recordingMatchSumDAO) SumsOfPatches(
+	ctx context.Context, patchRange *apb.PatchRange, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (map[string]*apb.MatchSum, error) {
+	return sumsOfPatches(ctx, m, m.Vulgate, patchRange, champion, enemy, tiers, region, role)
+}
+
+func (m *recordingMatchSumDAO) SumOfPatch(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region, role apb.Role,
+) (*apb.MatchSum, error) {
+	return sumOfPatch(ctx, m, m.Vulgate, patch, champion, enemy, tiers, region, role)
+}
+
+func (m *recordingMatchSumDAO) SumsOfRoles(
+	ctx context.Context, patch string, champion uint32, enemy int32,
+	tiers *apb.TierRange, region apb.Region,
+) (map[apb.Role]*apb.MatchSum, error) {
+	return sumsOfRoles(ctx, m, patch, champion, enemy, tiers, region)
+}
+
+func newTestVulgate() *vulgateImpl {
+	return &vulgateImpl{
+		proto: &apb.Vulgate{
+			Patches: []string{"6.13", "6.14", "6.15", "6.16", "6.17", "6.18"},
+			Tiers:   []string{TierGold, TierPlatinum},
+			Champions: map[uint32]*apb.Vulgate_Champion{
+				1: {}, 2: {}, 3: {},
+			},
+		},
+	}
+}
+
+func TestPlanAggregate(t *testing.T) {
+	vulgate := newTestVulgate()
+	patch := &apb.PatchRange{Min: "6.18", Max: "6.18"}
+	tier := &apb.TierRange{Min: 0x30, Max: 0x40}
+
+	plan := planAggregate(vulgate, 1, ANY_CHAMPION, patch, tier, apb.Region_NA, apb.Role_MID)
+
+	// 3 champions * 5 patches * 2 tiers, plus 4 other roles * 2 tiers
+	if want := 3*5*2 + 4*2; len(plan.filters) != want {
+		t.Errorf("Got %d planned rows - Want %d", len(plan.filters), want)
+	}
+
+	// everything the aggregator reads must be planned
+	rec := &recordingMatchSumDAO{Vulgate: vulgate, gets: map[MatchFiltersKey]int{}}
+	ctx := context.Background()
+	rec.SumsOfChampions(ctx, patch, ANY_CHAMPION, tier, apb.Region_NA, apb.Role_MID)
+	for _, p := range vulgate.FindPatches(patch) {
+		rec.SumOfPatch(ctx, p, 1, ANY_CHAMPION, tier, apb.Region_NA, apb.Role_MID)
+	}
+	rec.SumsOfRoles(ctx, patch.Max, 1, ANY_CHAMPION, tier, apb.Region_NA)
+
+	for key := range rec.gets {
+		if !plan.keys[key] {
+			t.Errorf("Read unplanned row %+v", key)
+		}
+	}
+	if len(rec.gets) != len(plan.keys) {
+		t.Errorf("Read %d rows - Planned %d", len(rec.gets), len(plan.keys))
+	}
+}
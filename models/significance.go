@@ -0,0 +1,58 @@
+package models
+
+import (
+	"math"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// minOutcomes is the number of wins and of losses a matchup needs for the normal
+// approximation of the z-test to hold.
+const minOutcomes = 5
+
+// evenWinRate is the win rate of a matchup neither champion is favored in.
+const evenWinRate = 0.5
+
+// proportionZTest tests whether a proportion p over n trials differs from p0, returning the
+// z score and two-sided p-value. Without any trials or variance it returns 0 and 1.
+func proportionZTest(p, n, p0 float64) (z, pValue float64) {
+	if n <= 0 {
+		return 0, 1
+	}
+	se := math.Sqrt(p0 * (1 - p0) / n)
+	if se == 0 || math.IsNaN(se) || math.IsNaN(p) {
+		return 0, 1
+	}
+	z = (p - p0) / se
+	return z, math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// cohensH is the effect size of the difference between two proportions, which unlike the
+// plain difference weighs differences near 0 and 1 as much as those near one half.
+func cohensH(p1, p2 float64) float64 {
+	return 2*math.Asin(math.Sqrt(p1)) - 2*math.Asin(math.Sqrt(p2))
+}
+
+// tooFewOutcomes checks if a proportion p over n trials has fewer than minOutcomes
+// successes or failures.
+func tooFewOutcomes(p, n float64) bool {
+	return p*n < minOutcomes || (1-p)*n < minOutcomes
+}
+
+// matchupSignificance tests whether the focus champion's win rate against the enemy differs
+// from an even matchup, at significance level alpha. The enemy's aggregate is of the same
+// games, its win rate the complement of the focus champion's, so it is no second sample.
+func matchupSignificance(focus *apb.MatchAggregate, alpha float64) *apb.Matchup_Significance {
+	p, n := focus.Statistics.Scalars.WinRate.Value, focus.Statistics.Scalars.GamesPlayed.Value
+
+	z, pValue := proportionZTest(p, n, evenWinRate)
+	tooSmall := tooFewOutcomes(p, n)
+	return &apb.Matchup_Significance{
+		WinRateDifference: p - evenWinRate,
+		ZScore:            z,
+		PValue:            pValue,
+		EffectSize:        cohensH(p, evenWinRate),
+		Significant:       !tooSmall && pValue < alpha,
+		SampleTooSmall:    tooSmall,
+	}
+}
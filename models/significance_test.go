@@ -0,0 +1,74 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func makeTestMatchupAggregate(winRate, games float64) *apb.MatchAggregate {
+	return &apb.MatchAggregate{
+		Statistics: &apb.MatchAggregateStatistics{
+			Scalars: &apb.MatchAggregateStatistics_Scalars{
+				WinRate:     &apb.MatchAggregateStatistics_Statistic{Value: winRate},
+				GamesPlayed: &apb.MatchAggregateStatistics_Statistic{Value: games},
+			},
+		},
+	}
+}
+
+func TestProportionZTest(t *testing.T) {
+	for _, test := range []struct {
+		p, n      float64
+		z, pValue float64
+	}{
+		{0.55, 1000, 3.1622777, 0.0015654},
+		{0.6, 50, 1.4142136, 0.1572992},
+		{0.5, 100, 0, 1},
+		{0.5, 0, 0, 1},
+	} {
+		z, pValue := proportionZTest(test.p, test.n, evenWinRate)
+		if math.Abs(z-test.z) > 1e-6 || math.Abs(pValue-test.pValue) > 1e-6 {
+			t.Errorf("[%v] Got %v, %v - Want %v, %v", test, z, pValue, test.z, test.pValue)
+		}
+	}
+}
+
+func TestMatchupSignificance(t *testing.T) {
+	for _, test := range []struct {
+		Description string
+		// the enemy's aggregate is of the same games, so its win rate is the complement
+		WinRate     float64
+		Games       float64
+		Significant bool
+		TooSmall    bool
+	}{
+		{"Large edge", 0.55, 1000, true, false},
+		{"Large disadvantage", 0.45, 1000, true, false},
+		{"Even", 0.51, 1000, false, false},
+		{"Too few games", 0.9, 10, false, true},
+	} {
+		focus := makeTestMatchupAggregate(test.WinRate, test.Games)
+		got := matchupSignificance(focus, 0.05)
+		if got.Significant != test.Significant {
+			t.Errorf("[%s] Got significant %v - Want %v", test.Description, got.Significant, test.Significant)
+		}
+		if got.SampleTooSmall != test.TooSmall {
+			t.Errorf("[%s] Got sample too small %v - Want %v", test.Description, got.SampleTooSmall, test.TooSmall)
+		}
+		wantDiff := test.WinRate - evenWinRate
+		if math.Abs(got.WinRateDifference-wantDiff) > 1e-9 {
+			t.Errorf("[%s] Got difference %v - Want %v", test.Description, got.WinRateDifference, wantDiff)
+		}
+		if (got.EffectSize > 0) != (wantDiff > 0) {
+			t.Errorf("[%s] Got effect size %v - Want the sign of %v", test.Description, got.EffectSize, wantDiff)
+		}
+
+		// the same matchup seen from the enemy is just as significant the other way
+		enemy := matchupSignificance(makeTestMatchupAggregate(1-test.WinRate, test.Games), 0.05)
+		if math.Abs(enemy.PValue-got.PValue) > 1e-9 || math.Abs(enemy.EffectSize+got.EffectSize) > 1e-9 {
+			t.Errorf("[%s] Got enemy %v - Want the mirror of %v", test.Description, enemy, got)
+		}
+	}
+}
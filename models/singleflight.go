@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+)
+
+// errFlightPanicked is returned to the callers sharing a call which panicked.
+var errFlightPanicked = errors.New("coalesced call panicked")
+
+// Counters of calls made through each flightGroup, served on the monitor port at /debug/vars.
+var (
+	matchSumGetFlightStats = expvar.NewMap("match_sum_get_flights")
+	aggregateFlightStats   = expvar.NewMap("aggregate_flights")
+)
+
+// flightGroup coalesces concurrent calls with the same key into a single call whose result
+// is shared by all callers.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[interface{}]*flightCall
+
+	// stats counts "calls" made and calls "collapsed" into another in-flight call.
+	stats *expvar.Map
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+func newFlightGroup(stats *expvar.Map) *flightGroup {
+	return &flightGroup{
+		calls: map[interface{}]*flightCall{},
+		stats: stats,
+	}
+}
+
+// Do calls fn unless a call with the same key is in flight, in which case it waits for
+// and returns that call's result. shared reports whether the result came from another caller.
+// If fn panics, the panic is passed on to its caller and the callers sharing the call get
+// errFlightPanicked.
+func (g *flightGroup) Do(key interface{}, fn func() (interface{}, error)) (val interface{}, err error, shared bool) {
+	g.mu.Lock()
+	// counted once joined, so a caller seen in the stats is sharing any call in flight
+	g.stats.Add("calls", 1)
+	if c, ok := g.calls[key]; ok {
+		g.stats.Add("collapsed", 1)
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := &flightCall{err: errFlightPanicked}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		c.wg.Done()
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+	}()
+
+	c.val, c.err = fn()
+	return c.val, c.err, false
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"expvar"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroup(t *testing.T) {
+	stats := new(expvar.Map).Init()
+	g := newFlightGroup(stats)
+
+	const callers = 10
+	var calls int32
+	release := make(chan struct{})
+
+	var done sync.WaitGroup
+	done.Add(callers)
+	results := make([]interface{}, callers)
+	for i := 0; i < callers; i++ {
+		go func(i int) {
+			defer done.Done()
+			results[i], _, _ = g.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "value", nil
+			})
+		}(i)
+	}
+
+	// the first call is held in flight until every other caller has joined it
+	for stats.Get("collapsed") == nil || stats.Get("collapsed").(*expvar.Int).Value() < callers-1 {
+		runtime.Gosched()
+	}
+	close(release)
+	done.Wait()
+
+	if calls != 1 {
+		t.Errorf("Got %d calls - Want 1", calls)
+	}
+	for i, result := range results {
+		if result != "value" {
+			t.Errorf("Got result %v for caller %d - Want value", result, i)
+		}
+	}
+	if collapsed := stats.Get("collapsed").(*expvar.Int).Value(); collapsed != callers-1 {
+		t.Errorf("Got %d collapsed calls - Want %d", collapsed, callers-1)
+	}
+
+	// calls after the flight lands are made again
+	g.Do("key", func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, nil
+	})
+	if calls != 2 {
+		t.Errorf("Got %d calls after landing - Want 2", calls)
+	}
+}
+
+func TestFlightGroupPanic(t *testing.T) {
+	g := newFlightGroup(new(expvar.Map).Init())
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("Got panic %v - Want boom", r)
+			}
+		}()
+		g.Do("key", func() (interface{}, error) {
+			panic("boom")
+		})
+	}()
+
+	// the panicked call must not be left in flight, or this would block forever
+	done := make(chan interface{})
+	go func() {
+		val, _, _ := g.Do("key", func() (interface{}, error) {
+			return "value", nil
+		})
+		done <- val
+	}()
+	select {
+	case val := <-done:
+		if val != "value" {
+			t.Errorf("Got %v - Want value", val)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Got a call blocked on a panicked call - Want it made")
+	}
+}
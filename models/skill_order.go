@@ -0,0 +1,130 @@
+package models
+
+import (
+	"sort"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// skillOpenerLength is the number of levels making up the opener of a skill order.
+const skillOpenerLength = 3
+
+// maxAbilityRank is the number of points an ability takes to max. Champions whose abilities
+// have a different number of ranks are treated the same.
+func maxAbilityRank(a apb.Ability) int {
+	if a == apb.Ability_R {
+		return 3
+	}
+	return 5
+}
+
+// abilityPriority is how far an ability got in a skill order.
+type abilityPriority struct {
+	ability apb.Ability
+	points  int
+	// maxedAt is the index of the level the ability was maxed at, or -1 if it was not
+	maxedAt int
+	// last is the index of the level of the ability's last point
+	last int
+}
+
+// skillMaxOrder gets the order in which a skill order maxes its abilities, e.g. R > Q > E > W.
+// The ultimate comes first whenever it is taken, as it is leveled whenever it can be. Abilities
+// not maxed by the end of the order come after those that are, by most points, then by the ones
+// which got their points first. Abilities never leveled are left out.
+func skillMaxOrder(order []apb.Ability) []apb.Ability {
+	priorities := map[apb.Ability]*abilityPriority{}
+	for i, a := range order {
+		p := priorities[a]
+		if p == nil {
+			p = &abilityPriority{ability: a, maxedAt: -1}
+			priorities[a] = p
+		}
+		p.points++
+		p.last = i
+		if p.points == maxAbilityRank(a) {
+			p.maxedAt = i
+		}
+	}
+
+	var sorted []abilityPriority
+	for _, p := range priorities {
+		sorted = append(sorted, *p)
+	}
+	sort.Sort(abilityPriorities(sorted))
+
+	ret := make([]apb.Ability, len(sorted))
+	for i, p := range sorted {
+		ret[i] = p.ability
+	}
+	return ret
+}
+
+// skillOpener gets the first skillOpenerLength levels of a skill order.
+func skillOpener(order []apb.Ability) []apb.Ability {
+	if len(order) > skillOpenerLength {
+		order = order[:skillOpenerLength]
+	}
+	ret := make([]apb.Ability, len(order))
+	copy(ret, order)
+	return ret
+}
+
+// groupSkillMaxOrders sums skill orders by their max order, keyed like skill orders.
+// Skill orders which cannot be parsed are left out.
+func groupSkillMaxOrders(orders map[string]*apb.MatchSum_Subscalars) map[string]*apb.MatchSum_Subscalars {
+	ret := map[string]*apb.MatchSum_Subscalars{}
+	for key, stats := range orders {
+		order, err := deserializeSkillOrder(key)
+		if err != nil {
+			continue
+		}
+		maxKey := serializeSkillOrder(skillMaxOrder(order))
+		cur := ret[maxKey]
+		if cur == nil {
+			cur = &apb.MatchSum_Subscalars{}
+		}
+		ret[maxKey] = addSubscalars(cur, stats)
+	}
+	return ret
+}
+
+// serializeSkillOrder is the inverse of deserializeSkillOrder.
+func serializeSkillOrder(order []apb.Ability) string {
+	ret := make([]byte, len(order))
+	for i, a := range order {
+		switch a {
+		case apb.Ability_Q:
+			ret[i] = 'Q'
+		case apb.Ability_W:
+			ret[i] = 'W'
+		case apb.Ability_E:
+			ret[i] = 'E'
+		case apb.Ability_R:
+			ret[i] = 'R'
+		}
+	}
+	return string(ret)
+}
+
+// abilityPriorities sorts abilities by max priority.
+type abilityPriorities []abilityPriority
+
+func (a abilityPriorities) Len() int      { return len(a) }
+func (a abilityPriorities) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a abilityPriorities) Less(i, j int) bool {
+	x, y := a[i], a[j]
+	if (x.ability == apb.Ability_R) != (y.ability == apb.Ability_R) {
+		return x.ability == apb.Ability_R
+	}
+	if (x.maxedAt >= 0) != (y.maxedAt >= 0) {
+		return x.maxedAt >= 0
+	}
+	if x.maxedAt >= 0 {
+		return x.maxedAt < y.maxedAt
+	}
+	if x.points != y.points {
+		return x.points > y.points
+	}
+	return x.last < y.last
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func TestSkillMaxOrder(t *testing.T) {
+	for _, test := range []struct {
+		order    string
+		maxOrder string
+	}{
+		{"QWEQQRQWQWRWWEEREE", "RQWE"},
+		// W is maxed before Q, though Q was leveled first
+		{"QWEWWRWQWQRQQEEREE", "RWQE"},
+		// nothing is maxed, so the ability with the most points comes first
+		{"QEWQQ", "QEW"},
+		{"QWEQQRQ", "RQWE"},
+		{"WQEQQ", "QWE"},
+		{"Q", "Q"},
+		{"", ""},
+	} {
+		order, err := deserializeSkillOrder(test.order)
+		if err != nil {
+			t.Errorf("[%v] Got error %v - Want nil", test.order, err)
+			continue
+		}
+		if got := serializeSkillOrder(skillMaxOrder(order)); got != test.maxOrder {
+			t.Errorf("[%v] Got %v - Want %v", test.order, got, test.maxOrder)
+		}
+	}
+}
+
+func TestSkillOpener(t *testing.T) {
+	for _, test := range []struct {
+		order  string
+		opener string
+	}{
+		{"QWEQQRQ", "QWE"},
+		{"QW", "QW"},
+		{"", ""},
+	} {
+		order, err := deserializeSkillOrder(test.order)
+		if err != nil {
+			t.Errorf("[%v] Got error %v - Want nil", test.order, err)
+			continue
+		}
+		if got := serializeSkillOrder(skillOpener(order)); got != test.opener {
+			t.Errorf("[%v] Got %v - Want %v", test.order, got, test.opener)
+		}
+	}
+}
+
+func TestGroupSkillMaxOrders(t *testing.T) {
+	got := groupSkillMaxOrders(map[string]*apb.MatchSum_Subscalars{
+		"QWEQQ": {Plays: 3, Wins: 2},
+		"WQEQQ": {Plays: 2, Wins: 1},
+		"QEWQQ": {Plays: 4, Wins: 1},
+		"QX":    {Plays: 1, Wins: 1},
+	})
+	want := map[string]*apb.MatchSum_Subscalars{
+		"QWE": {Plays: 5, Wins: 3},
+		"QEW": {Plays: 4, Wins: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v - Want %v", got, want)
+	}
+}
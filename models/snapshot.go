@@ -0,0 +1,224 @@
+package models
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/gocql/gocql"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+// maxSnapshotRecordSize bounds a single record so corrupt files fail instead of allocating wildly.
+const maxSnapshotRecordSize = 64 << 20
+
+// MatchSumRow is a row of the match_sums table.
+type MatchSumRow struct {
+	Filters *apb.MatchFilters
+	// RawSum is the serialized MatchSum as stored in Cassandra.
+	RawSum []byte
+}
+
+// MatchFiltersKey is a comparable representation of MatchFilters, usable as a map key.
+type MatchFiltersKey struct {
+	ChampionId int32
+	EnemyId    int32
+	Patch      string
+	Tier       int32
+	Region     apb.Region
+	Role       apb.Role
+}
+
+// NewMatchFiltersKey constructs the key of a set of MatchFilters.
+func NewMatchFiltersKey(f *apb.MatchFilters) MatchFiltersKey {
+	return MatchFiltersKey{
+		ChampionId: f.ChampionId,
+		EnemyId:    f.EnemyId,
+		Patch:      f.Patch,
+		Tier:       f.Tier,
+		Region:     f.Region,
+		Role:       f.Role,
+	}
+}
+
+// MatchSumRowWriter writes rows as a stream of length-delimited records:
+// the MatchFilters protobuf followed by the raw MatchSum protobuf.
+type MatchSumRowWriter struct {
+	w *bufio.Writer
+}
+
+// NewMatchSumRowWriter constructs a new MatchSumRowWriter. Flush must be called when done.
+func NewMatchSumRowWriter(w io.Writer) *MatchSumRowWriter {
+	return &MatchSumRowWriter{w: bufio.NewWriter(w)}
+}
+
+// Write writes a row.
+func (w *MatchSumRowWriter) Write(row *MatchSumRow) error {
+	rawFilters, err := proto.Marshal(row.Filters)
+	if err != nil {
+		return fmt.Errorf("error marshaling filters: %v", err)
+	}
+	if err := w.writeRecord(rawFilters); err != nil {
+		return err
+	}
+	return w.writeRecord(row.RawSum)
+}
+
+func (w *MatchSumRowWriter) writeRecord(b []byte) error {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+	if _, err := w.w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Flush flushes buffered rows to the underlying writer.
+func (w *MatchSumRowWriter) Flush() error {
+	return w.w.Flush()
+}
+
+// MatchSumRowReader reads rows written by a MatchSumRowWriter.
+type MatchSumRowReader struct {
+	r *bufio.Reader
+}
+
+// NewMatchSumRowReader constructs a new MatchSumRowReader.
+func NewMatchSumRowReader(r io.Reader) *MatchSumRowReader {
+	return &MatchSumRowReader{r: bufio.NewReader(r)}
+}
+
+// Read reads the next row. It returns io.EOF when there are no rows left.
+func (r *MatchSumRowReader) Read() (*MatchSumRow, error) {
+	rawFilters, err := r.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	rawSum, err := r.readRecord()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var filters apb.MatchFilters
+	if err := proto.Unmarshal(rawFilters, &filters); err != nil {
+		return nil, fmt.Errorf("error unmarshaling filters: %v", err)
+	}
+	return &MatchSumRow{Filters: &filters, RawSum: rawSum}, nil
+}
+
+func (r *MatchSumRowReader) readRecord() ([]byte, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSnapshotRecordSize {
+		return nil, fmt.Errorf("record of %d bytes exceeds maximum size", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+const (
+	// Snapshot statements use the session's keyspace so that snapshots can be loaded into any keyspace.
+	stmtScanSums = `SELECT champion_id, enemy_id, patch, tier, region, role, match_sum
+		FROM match_sums`
+	stmtPutSum = `INSERT INTO match_sums
+		(champion_id, enemy_id, patch, tier, region, role, match_sum)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	// Rows fetched per page while dumping.
+	snapshotPageSize = 1000
+)
+
+// SnapshotFilter selects the rows of a snapshot. Nil sets match everything.
+type SnapshotFilter struct {
+	Patches map[string]bool
+	Regions map[apb.Region]bool
+}
+
+// Matches checks if a row with the given filters is selected.
+func (s *SnapshotFilter) Matches(f *apb.MatchFilters) bool {
+	if s.Patches != nil && !s.Patches[f.Patch] {
+		return false
+	}
+	if s.Regions != nil && !s.Regions[f.Region] {
+		return false
+	}
+	return true
+}
+
+// DumpMatchSums streams the rows of match_sums selected by the filter to w, returning the number of rows written.
+// The table is scanned in full as patch and region are not a prefix of its primary key.
+func DumpMatchSums(
+	ctx context.Context, session *gocql.Session, filter *SnapshotFilter, w *MatchSumRowWriter,
+) (int, error) {
+	iter := session.Query(stmtScanSums).WithContext(ctx).PageSize(snapshotPageSize).Iter()
+
+	var n int
+	var region, role int32
+	for {
+		row := &MatchSumRow{Filters: &apb.MatchFilters{}}
+		f := row.Filters
+		if !iter.Scan(&f.ChampionId, &f.EnemyId, &f.Patch, &f.Tier, &region, &role, &row.RawSum) {
+			break
+		}
+		f.Region = apb.Region(region)
+		f.Role = apb.Role(role)
+
+		if !filter.Matches(f) {
+			continue
+		}
+		if err := w.Write(row); err != nil {
+			iter.Close()
+			return n, fmt.Errorf("error writing row: %v", err)
+		}
+		n++
+	}
+	if err := iter.Close(); err != nil {
+		return n, fmt.Errorf("error scanning sums from Cassandra: %v", err)
+	}
+	return n, w.Flush()
+}
+
+// LoadMatchSums inserts the rows read from r selected by the filter into match_sums,
+// returning the number of rows inserted. Existing rows are overwritten.
+func LoadMatchSums(
+	ctx context.Context, session *gocql.Session, filter *SnapshotFilter, r *MatchSumRowReader,
+) (int, error) {
+	var n int
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("error reading row: %v", err)
+		}
+
+		f := row.Filters
+		if !filter.Matches(f) {
+			continue
+		}
+		if err := session.Query(
+			stmtPutSum, f.ChampionId, f.EnemyId, f.Patch,
+			f.Tier, int32(f.Region), int32(f.Role), row.RawSum,
+		).WithContext(ctx).Exec(); err != nil {
+			return n, fmt.Errorf("error inserting sum into Cassandra: %v", err)
+		}
+		n++
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	apb "github.com/asunaio/apollo/gen-go/asuna"
+)
+
+func TestMatchSumRowRoundTrip(t *testing.T) {
+	rows := []*MatchSumRow{
+		{
+			Filters: &apb.MatchFilters{ChampionId: 1, EnemyId: ANY_CHAMPION, Patch: "6.17", Tier: 0x30, Region: apb.Region_NA, Role: apb.Role_TOP},
+			RawSum:  []byte("first"),
+		},
+		{
+			Filters: &apb.MatchFilters{ChampionId: 2, EnemyId: 3, Patch: "6.18", Tier: 0x70, Region: apb.Region_KR, Role: apb.Role_SUPPORT},
+			RawSum:  []byte{},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewMatchSumRowWriter(&buf)
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("Could not write row: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Could not flush rows: %v", err)
+	}
+
+	r := NewMatchSumRowReader(bytes.NewReader(buf.Bytes()))
+	for _, want := range rows {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("Could not read row: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Got %+v - Want %+v", got, want)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Got error %v after last row - Want EOF", err)
+	}
+
+	// truncated files are corrupt, not empty
+	r = NewMatchSumRowReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	r.Read()
+	if _, err := r.Read(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Got error %v for truncated row - Want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestSnapshotFilter(t *testing.T) {
+	f := &apb.MatchFilters{Patch: "6.18", Region: apb.Region_NA}
+	for _, test := range []struct {
+		Description string
+		Filter      *SnapshotFilter
+		Want        bool
+	}{
+		{
+			Description: "Empty filter",
+			Filter:      &SnapshotFilter{},
+			Want:        true,
+		},
+		{
+			Description: "Matching patch and region",
+			Filter: &SnapshotFilter{
+				Patches: map[string]bool{"6.17": true, "6.18": true},
+				Regions: map[apb.Region]bool{apb.Region_NA: true},
+			},
+			Want: true,
+		},
+		{
+			Description: "Other patch",
+			Filter:      &SnapshotFilter{Patches: map[string]bool{"6.17": true}},
+			Want:        false,
+		},
+		{
+			Description: "Other region",
+			Filter:      &SnapshotFilter{Regions: map[apb.Region]bool{apb.Region_EUW: true}},
+			Want:        false,
+		},
+	} {
+		if got := test.Filter.Matches(f); got != test.Want {
+			t.Errorf("[%v] Got %v - Want %v", test.Description, got, test.Want)
+		}
+	}
+}
@@ -29,6 +29,9 @@ type Vulgate interface {
 	// GetChampionInfo gets information about a champion.
 	GetChampionInfo(id uint32) *apb.Vulgate_Champion
 
+	// GetItemInfo gets information about an item, or nil if it is unknown.
+	GetItemInfo(id uint32) *apb.Vulgate_Item
+
 	// GetPatchTimes gets times for a patch.
 	GetPatchTimes(rg *apb.PatchRange) *apb.Vulgate_PatchTime
 
@@ -123,6 +126,10 @@ func (v *vulgateImpl) GetChampionInfo(id uint32) *apb.Vulgate_Champion {
 	return v.proto.Champions[id]
 }
 
+func (v *vulgateImpl) GetItemInfo(id uint32) *apb.Vulgate_Item {
+	return v.proto.Items[id]
+}
+
 func (v *vulgateImpl) GetPatchTimes(rg *apb.PatchRange) *apb.Vulgate_PatchTime {
 	// TODO(pradyuman): implement
 	return &apb.Vulgate_PatchTime{}
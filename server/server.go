@@ -18,7 +18,7 @@ type Server struct {
 func (s *Server) GetChampion(ctx context.Context, in *apb.GetChampionRequest) (*apb.Champion, error) {
 	champion, err := s.Champions.Get(ctx, in)
 	if err != nil {
-		return nil, grpc.Errorf(codes.Internal, "could not get champion: %v", err)
+		return nil, grpc.Errorf(errorCode(ctx, err), "could not get champion: %v", err)
 	}
 	return champion, nil
 }
@@ -26,7 +26,7 @@ func (s *Server) GetChampion(ctx context.Context, in *apb.GetChampionRequest) (*
 func (s *Server) GetMatchup(ctx context.Context, in *apb.GetMatchupRequest) (*apb.Matchup, error) {
 	matchup, err := s.Champions.GetMatchup(ctx, in)
 	if err != nil {
-		return nil, grpc.Errorf(codes.Internal, "could not get matchup: %v", err)
+		return nil, grpc.Errorf(errorCode(ctx, err), "could not get matchup: %v", err)
 	}
 	return matchup, nil
 }
@@ -36,9 +36,9 @@ func (s *Server) GetProfile(ctx context.Context, in *apb.GetProfileRequest) (*ap
 }
 
 func (s *Server) GetMatchSum(ctx context.Context, in *apb.GetMatchSumRequest) (*apb.MatchSum, error) {
-	sum, err := s.MatchSumDAO.Sum(in.Filters)
+	sum, err := s.MatchSumDAO.Sum(ctx, in.Filters)
 	if err != nil {
-		return nil, grpc.Errorf(codes.Internal, "could not retrieve match sum: %v", err)
+		return nil, grpc.Errorf(errorCode(ctx, err), "could not retrieve match sum: %v", err)
 	}
 	if sum == nil {
 		return nil, grpc.Errorf(codes.NotFound, "no match sum found for filter set")
@@ -49,3 +49,19 @@ func (s *Server) GetMatchSum(ctx context.Context, in *apb.GetMatchSumRequest) (*
 func (s *Server) GetStatic(ctx context.Context, in *ptypes.Empty) (*apb.Static, error) {
 	return nil, grpc.Errorf(codes.Unimplemented, "GetStatic unimplemented")
 }
+
+// errorCode gets the code of a failed request, reporting bad arguments and deadlines and
+// cancellations of the client instead of masking them as internal errors.
+func errorCode(ctx context.Context, err error) codes.Code {
+	if err == models.ErrInvalidPageToken {
+		return codes.InvalidArgument
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	case context.Canceled:
+		return codes.Canceled
+	default:
+		return codes.Internal
+	}
+}